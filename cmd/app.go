@@ -0,0 +1,370 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adampresley/pusher/pkg/commands"
+	"github.com/adampresley/pusher/pkg/contextinfo"
+	"github.com/adampresley/pusher/pkg/project"
+	"github.com/adampresley/pusher/pkg/rendering"
+	"github.com/adampresley/pusher/pkg/sshutils"
+	"github.com/melbahja/goph"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+const (
+	acmeFile string = "~/traefik/ssl-certs/acme.json"
+)
+
+var appCmd = &cobra.Command{
+	Use:   "app",
+	Short: "Start, stop, restart, or destroy your application",
+}
+
+var appStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start your application",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runAppStep(cmd, &commands.StartApplicationCommand)
+	},
+}
+
+var appStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop your application",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runAppStep(cmd, &commands.StopApplicationCommand)
+	},
+}
+
+var appRestartCmd = &cobra.Command{
+	Use:   "restart",
+	Short: "Restart your application",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runAppStep(cmd, &commands.RestartApplicationCommand)
+	},
+}
+
+var appDestroyCmd = &cobra.Command{
+	Use:   "destroy",
+	Short: "Remove your application from the server",
+	Long: `Stop and remove your application's containers, images, folder,
+and certificate from the server. Mount folders, which usually hold
+your application's data, are only removed with --remove-mounts.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			err error
+		)
+
+		debug, _ := cmd.Flags().GetBool("debug")
+		ctx := cmd.Context()
+		removeMounts, _ := cmd.Flags().GetBool("remove-mounts")
+		nonInteractive := isNonInteractive(cmd)
+
+		rendering.Header("Destroy an Application")
+
+		proj := loadAppProject(cmd)
+
+		if removeMounts {
+			if nonInteractive {
+				rendering.Error("--remove-mounts deletes data and has to be confirmed by typing the application name. It can't be used with --yes.")
+				os.Exit(1)
+			}
+
+			for _, path := range proj.MountDirectories() {
+				if !isSafeToRemove(path) {
+					rendering.Error("Refusing to remove mount folder '%s'.", path)
+					os.Exit(1)
+				}
+			}
+		}
+
+		rendering.Warning("This removes '%s' from '%s':", proj.ServiceName, proj.Host)
+		rendering.Print("  - its containers and images")
+		rendering.Print("  - ~/applications/%s, including its env file", proj.ServiceName)
+
+		if proj.Domain != "" {
+			rendering.Print("  - the certificate for '%s'. Traefik restarts to forget it.", proj.Domain)
+		}
+
+		if removeMounts {
+			for _, path := range proj.MountDirectories() {
+				rendering.Print("  - mount folder %s and everything in it", path)
+			}
+		}
+
+		rendering.BlankLine()
+
+		if !nonInteractive {
+			if removeMounts {
+				typed, _ := pterm.DefaultInteractiveTextInput.Show(fmt.Sprintf("Type '%s' to confirm", proj.ServiceName))
+
+				if strings.TrimSpace(typed) != proj.ServiceName {
+					rendering.Warning("Name did not match. Aborting.")
+					os.Exit(0)
+				}
+			} else {
+				confirmation, _ := pterm.DefaultInteractiveConfirm.Show("Are you sure you wish to destroy this application?")
+
+				if !confirmation {
+					rendering.Warning("User cancelled. Aborting.")
+					os.Exit(0)
+				}
+			}
+		}
+
+		sshClient, contextInfo := connectToProject(proj)
+		defer sshClient.Close()
+
+		executor := sshutils.NewGophExecutor(sshClient)
+
+		if err = commands.DestroyApplicationCommand.Run(ctx, executor, contextInfo, debug); err != nil {
+			os.Exit(1)
+		}
+
+		if err = removeCertificate(ctx, executor, proj.Domain); err != nil {
+			rendering.Error("%s", err.Error())
+			os.Exit(1)
+		}
+
+		if removeMounts && len(proj.Mounts) > 0 {
+			if err = commands.RemoveMountDirectoriesCommand.Run(ctx, executor, contextInfo, debug); err != nil {
+				os.Exit(1)
+			}
+		}
+
+		/*
+		 * The deployed images are gone, so there is nothing left to
+		 * roll back to.
+		 */
+		proj.ActiveVersion = 0
+		proj.History = project.Deployments{}
+
+		if err = proj.Save(); err != nil {
+			rendering.Error("The application was destroyed, but there was a problem updating the local project file: %s", err.Error())
+			os.Exit(1)
+		}
+
+		rendering.Header("💥 '%s' destroyed.", proj.ServiceName)
+	},
+}
+
+/*
+removeCertificate removes the certificate Traefik requested for domain
+from acme.json. Traefik keeps certificates in memory until it restarts,
+so it is restarted when one was removed. The file is edited here rather
+than on the server, which has nothing to edit JSON with.
+*/
+func removeCertificate(ctx context.Context, executor sshutils.Executor, domain string) error {
+	var (
+		err     error
+		b       []byte
+		changed bool
+	)
+
+	if domain == "" {
+		return nil
+	}
+
+	spinner := rendering.Spinner("Removing certificate...")
+
+	if b, err = executor.Run(ctx, "[ ! -f "+acmeFile+" ] || sudo cat "+acmeFile); err != nil {
+		spinner.Fail("Unable to read " + acmeFile)
+		return fmt.Errorf("There was a problem reading %s: %s", acmeFile, err.Error())
+	}
+
+	if b, changed, err = withoutCertificate(b, domain); err != nil {
+		spinner.Fail("Unable to read " + acmeFile)
+		return fmt.Errorf("There was a problem reading %s: %s", acmeFile, err.Error())
+	}
+
+	if !changed {
+		spinner.Success("No certificate to remove.")
+		return nil
+	}
+
+	if _, err = executor.Stream(ctx, "sudo tee "+acmeFile+" > /dev/null", bytes.NewReader(b)); err != nil {
+		spinner.Fail("Unable to write " + acmeFile)
+		return fmt.Errorf("There was a problem writing %s: %s", acmeFile, err.Error())
+	}
+
+	if _, err = executor.Run(ctx, "sudo docker restart traefik"); err != nil {
+		spinner.Fail("Unable to restart Traefik")
+		return fmt.Errorf("There was a problem restarting Traefik: %s", err.Error())
+	}
+
+	spinner.Success("Certificate removed.")
+	return nil
+}
+
+/*
+withoutCertificate removes the certificates for domain from the contents
+of acme.json, leaving everything else as it was. changed is false when
+there were none, or no acme.json at all.
+*/
+func withoutCertificate(acme []byte, domain string) (result []byte, changed bool, err error) {
+	var (
+		resolvers map[string]map[string]json.RawMessage
+	)
+
+	if len(bytes.TrimSpace(acme)) == 0 {
+		return acme, false, nil
+	}
+
+	if err = json.Unmarshal(acme, &resolvers); err != nil {
+		return acme, false, err
+	}
+
+	for _, resolver := range resolvers {
+		var certificates []json.RawMessage
+
+		if err = json.Unmarshal(resolver["Certificates"], &certificates); err != nil || len(certificates) == 0 {
+			continue
+		}
+
+		kept := []json.RawMessage{}
+
+		for _, certificate := range certificates {
+			var c struct {
+				Domain struct {
+					Main string `json:"main"`
+				} `json:"domain"`
+			}
+
+			if json.Unmarshal(certificate, &c) == nil && c.Domain.Main == domain {
+				changed = true
+				continue
+			}
+
+			kept = append(kept, certificate)
+		}
+
+		if resolver["Certificates"], err = json.Marshal(kept); err != nil {
+			return acme, false, err
+		}
+	}
+
+	if !changed {
+		return acme, false, nil
+	}
+
+	result, err = json.MarshalIndent(resolvers, "", "  ")
+	return result, true, err
+}
+
+/*
+runAppStep runs a step against the running container, which for
+blue/green projects is the active colour.
+*/
+func runAppStep(cmd *cobra.Command, step *sshutils.Step) {
+	var (
+		err         error
+		sshClient   *goph.Client
+		contextInfo contextinfo.ContextInfo
+	)
+
+	debug, _ := cmd.Flags().GetBool("debug")
+	ctx := cmd.Context()
+	proj := loadAppProject(cmd)
+
+	sshClient, contextInfo = connectToProject(proj)
+	defer sshClient.Close()
+
+	executor := sshutils.NewGophExecutor(sshClient)
+
+	if err = resolveActiveColor(ctx, executor, proj, &contextInfo); err != nil {
+		rendering.Error("%s", err.Error())
+		os.Exit(1)
+	}
+
+	if err = step.Run(ctx, executor, contextInfo, debug); err != nil {
+		os.Exit(1)
+	}
+}
+
+func loadAppProject(cmd *cobra.Command) *project.PusherProject {
+	proj, err := loadProject(cmd)
+
+	if err != nil {
+		rendering.Error("There was a problem loading your project configuration file: %s", err.Error())
+		os.Exit(1)
+	}
+
+	if proj.Host == "" || proj.ServiceName == "" {
+		rendering.Error("This project hasn't been deployed yet. Run 'pusher deploy' first.")
+		os.Exit(1)
+	}
+
+	return proj
+}
+
+/*
+isSafeToRemove guards against mounts that would have us delete the
+home directory or a top level folder such as /var, or that look like a
+glob rather than a single folder.
+*/
+func isSafeToRemove(path string) bool {
+	if strings.ContainsAny(path, "*?[]{}") {
+		return false
+	}
+
+	if path == "~" {
+		return false
+	}
+
+	if rest, found := strings.CutPrefix(path, "~/"); found {
+		return filepath.Clean("/"+rest) != "/"
+	}
+
+	cleaned := filepath.Clean(path)
+
+	if filepath.IsAbs(cleaned) {
+		return strings.Count(cleaned, "/") >= 2
+	}
+
+	return cleaned != "." && !strings.HasPrefix(cleaned, "..")
+}
+
+func init() {
+	for _, c := range []*cobra.Command{appStartCmd, appStopCmd, appRestartCmd, appDestroyCmd} {
+		c.Flags().BoolP("debug", "d", false, "Enable debug output")
+		appCmd.AddCommand(c)
+	}
+
+	appDestroyCmd.Flags().Bool("remove-mounts", false, "Also delete the application's mount folders on the server")
+	addNonInteractiveFlags(appDestroyCmd)
+
+	rootCmd.AddCommand(appCmd)
+}
@@ -0,0 +1,143 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/adampresley/pusher/pkg/commands"
+	"github.com/adampresley/pusher/pkg/project"
+	"github.com/adampresley/pusher/pkg/sshtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsSafeToRemove(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "~/applications/myapp/data", want: true},
+		{path: "~/uploads", want: true},
+		{path: "/srv/data", want: true},
+		{path: "~", want: false},
+		{path: "~/", want: false},
+		{path: "/var", want: false},
+		{path: "/", want: false},
+		{path: "/var/*", want: false},
+		{path: "~/data?", want: false},
+		{path: "/srv/[a-z]", want: false},
+		{path: ".", want: false},
+		{path: "../data", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, isSafeToRemove(tt.path))
+		})
+	}
+}
+
+func TestMountDirectoryCommandsQuotePaths(t *testing.T) {
+	proj := newTestProject(t)
+	proj.Mounts = project.Mounts{
+		{Local: "./my data", Remote: "/data"},
+		{Local: "/srv/it's here", Remote: "/srv"},
+	}
+
+	info := newTestContext(proj)
+
+	assert.Equal(t,
+		[]string{`sudo rm -rf -- "$HOME"/'applications/myapp/my data' && sudo rm -rf -- '/srv/it'\''s here' && true`},
+		stepCommands(info, &commands.RemoveMountDirectoriesCommand),
+	)
+
+	assert.Equal(t,
+		[]string{`mkdir -p -- "$HOME"/'applications/myapp/my data' && mkdir -p -- '/srv/it'\''s here' && true`},
+		stepCommands(info, &commands.CreateMountDirectoriesCommand),
+	)
+}
+
+func TestDestroyApplicationMatchesImagesExactly(t *testing.T) {
+	proj := newTestProject(t)
+	proj.ServiceName = "my.app"
+
+	got := stepCommands(newTestContext(proj), &commands.DestroyApplicationCommand)[1]
+
+	assert.Contains(t, got, `--filter reference='my.app' --filter reference='*/''my.app' --filter reference='*/*/''my.app'`)
+	assert.NotContains(t, got, "grep")
+}
+
+const testAcme = `{
+  "letsencrypt": {
+    "Account": {"Email": "me@example.com"},
+    "Certificates": [
+      {"domain": {"main": "myapp.example.com"}, "certificate": "a", "key": "b", "Store": "default"},
+      {"domain": {"main": "other.example.com"}, "certificate": "c", "key": "d", "Store": "default"}
+    ]
+  }
+}`
+
+func TestRemoveCertificate(t *testing.T) {
+	recorder := &sshtest.Recorder{
+		Handler: func(command string, stdin []byte) (string, int) {
+			if command == "[ ! -f "+acmeFile+" ] || sudo cat "+acmeFile {
+				return testAcme, 0
+			}
+
+			return "", 0
+		},
+	}
+
+	assert.NoError(t, removeCertificate(context.Background(), recorder, "myapp.example.com"))
+	assert.Equal(t, []string{
+		"[ ! -f ~/traefik/ssl-certs/acme.json ] || sudo cat ~/traefik/ssl-certs/acme.json",
+		"sudo tee ~/traefik/ssl-certs/acme.json > /dev/null",
+		"sudo docker restart traefik",
+	}, recorder.Commands())
+
+	var written map[string]struct {
+		Account      map[string]string
+		Certificates []struct {
+			Domain struct{ Main string }
+		}
+	}
+
+	assert.NoError(t, json.Unmarshal(recorder.Execs()[1].Stdin, &written))
+	assert.Equal(t, "me@example.com", written["letsencrypt"].Account["Email"])
+	assert.Len(t, written["letsencrypt"].Certificates, 1)
+	assert.Equal(t, "other.example.com", written["letsencrypt"].Certificates[0].Domain.Main)
+}
+
+func TestRemoveCertificateLeavesOtherDomains(t *testing.T) {
+	for _, acme := range []string{"", testAcme} {
+		recorder := &sshtest.Recorder{
+			Handler: func(command string, stdin []byte) (string, int) {
+				return acme, 0
+			},
+		}
+
+		assert.NoError(t, removeCertificate(context.Background(), recorder, "unknown.example.com"))
+		assert.Len(t, recorder.Commands(), 1, "nothing is written and Traefik isn't restarted")
+	}
+}
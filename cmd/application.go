@@ -0,0 +1,631 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adampresley/pusher/pkg/commands"
+	"github.com/adampresley/pusher/pkg/contextinfo"
+	"github.com/adampresley/pusher/pkg/local"
+	"github.com/adampresley/pusher/pkg/project"
+	"github.com/adampresley/pusher/pkg/rendering"
+	"github.com/adampresley/pusher/pkg/sshutils"
+	"github.com/melbahja/goph"
+	"github.com/pterm/pterm"
+)
+
+/*
+resolveColors fills in the colour to deploy to and the currently active
+colour when the project uses blue/green deploys. Standard deploys leave
+both empty, which keeps the single-container compose file.
+*/
+func resolveColors(ctx context.Context, executor sshutils.Executor, proj *project.PusherProject, info *contextinfo.ContextInfo) error {
+	var (
+		err error
+		b   []byte
+	)
+
+	if !proj.IsBlueGreen() {
+		return nil
+	}
+
+	info.Priority = strconv.FormatInt(time.Now().Unix(), 10)
+
+	/*
+	 * A dry run can't ask the server, so show a first blue deploy.
+	 */
+	if info.DryRun {
+		info.Color = "blue"
+		return nil
+	}
+
+	if b, err = executor.Run(ctx, info.ExpandCommand(`cat ~/applications/{{.ServiceName}}/.active-color 2>/dev/null || true`)); err != nil {
+		return fmt.Errorf("Unable to determine the active colour: %s", err.Error())
+	}
+
+	info.PreviousColor = strings.TrimSpace(string(b))
+	info.Color = "blue"
+
+	if info.PreviousColor == "blue" {
+		info.Color = "green"
+	}
+
+	return nil
+}
+
+/*
+connectToProject opens an SSH connection to the project's host, exiting
+when it can't.
+*/
+func connectToProject(proj *project.PusherProject) (*goph.Client, contextinfo.ContextInfo) {
+	spinner := rendering.Spinner(fmt.Sprintf("Getting SSH client for host '%s'", proj.Host))
+	sshClient, contextInfo, err := sshutils.GetClientFromProject(proj)
+
+	if err != nil {
+		/*
+		 * Say why, even for commands that keep quiet, such as status --json.
+		 */
+		pterm.EnableOutput()
+		spinner.Fail(fmt.Sprintf("Unable to get SSH client for host '%s': %s", proj.Host, err.Error()))
+		os.Exit(1)
+	}
+
+	spinner.Success("Connection established.")
+	return sshClient, contextInfo
+}
+
+/*
+resolveActiveColor points info at the running container. For blue/green
+projects that is the colour in .active-color, rather than the next colour
+a deploy would use.
+*/
+func resolveActiveColor(ctx context.Context, executor sshutils.Executor, proj *project.PusherProject, info *contextinfo.ContextInfo) error {
+	if err := resolveColors(ctx, executor, proj, info); err != nil {
+		return err
+	}
+
+	if proj.IsBlueGreen() && !info.DryRun {
+		info.Color = info.PreviousColor
+	}
+
+	return nil
+}
+
+/*
+resolveContainer returns the name of the container to work with: the
+named service's container, or the application's running container.
+*/
+func resolveContainer(ctx context.Context, executor sshutils.Executor, proj *project.PusherProject, info *contextinfo.ContextInfo, service string) (string, error) {
+	if service != "" {
+		return service, nil
+	}
+
+	if err := resolveActiveColor(ctx, executor, proj, info); err != nil {
+		return "", err
+	}
+
+	if info.Color != "" {
+		return proj.ServiceName + "-" + info.Color, nil
+	}
+
+	return proj.ServiceName, nil
+}
+
+/*
+startApplication starts the application container and, when configured,
+checks its health. Blue/green deploys wait for the new colour to become
+healthy before stopping the old one, and remove the new container again
+if it never does. Standard deploys that fail the health check print the
+container logs and go back to the previously active version.
+*/
+func startApplication(ctx context.Context, executor sshutils.Executor, proj *project.PusherProject, info contextinfo.ContextInfo, debug bool) error {
+	var (
+		err error
+	)
+
+	if err = commands.StartApplicationCommand.Run(ctx, executor, info, debug); err != nil {
+		return err
+	}
+
+	if proj.IsBlueGreen() {
+		return switchBlueGreenApplication(ctx, executor, proj, info, debug)
+	}
+
+	if !proj.HealthCheck.IsEnabled() {
+		return nil
+	}
+
+	if err = commands.HealthCheckApplicationCommand.Run(ctx, executor, info, debug); err != nil {
+		printApplicationLogs(ctx, executor, info)
+		restorePreviousVersion(ctx, executor, proj, info, debug)
+		return err
+	}
+
+	return nil
+}
+
+func switchBlueGreenApplication(ctx context.Context, executor sshutils.Executor, proj *project.PusherProject, info contextinfo.ContextInfo, debug bool) error {
+	var (
+		err error
+	)
+
+	err = commands.WaitForBlueGreenApplicationCommand.Run(ctx, executor, info, debug)
+
+	if err == nil && proj.HealthCheck.IsEnabled() {
+		err = commands.HealthCheckApplicationCommand.Run(ctx, executor, info, debug)
+	}
+
+	/*
+	 * The new colour starts with its router off. Turn it on only now it
+	 * has passed its checks.
+	 */
+	if err == nil {
+		err = commands.RouteBlueGreenApplicationCommand.Run(ctx, executor, info, debug)
+	}
+
+	if err != nil {
+		printApplicationLogs(ctx, executor, info)
+		_ = commands.StopBlueGreenApplicationCommand.Run(ctx, executor, info, debug)
+		return err
+	}
+
+	return commands.SwitchBlueGreenApplicationCommand.Run(ctx, executor, info, debug)
+}
+
+/*
+restorePreviousVersion points the compose file back at the version that
+was active before this deploy and restarts it.
+*/
+func restorePreviousVersion(ctx context.Context, executor sshutils.Executor, proj *project.PusherProject, info contextinfo.ContextInfo, debug bool) {
+	previous, found := proj.History.Find(proj.ActiveVersion)
+
+	if !found {
+		rendering.Warning("There is no previous version to restore.")
+		return
+	}
+
+	rendering.Warning("Restoring version %d...", previous.Version)
+	info.ImageTag = previous.Tag()
+
+	if err := commands.SetupApplicationCommand.Run(ctx, executor, info, debug); err != nil {
+		return
+	}
+
+	if err := commands.StartApplicationCommand.Run(ctx, executor, info, debug); err != nil {
+		return
+	}
+
+	rendering.Success("Version %d restored.", previous.Version)
+}
+
+func printApplicationLogs(ctx context.Context, executor sshutils.Executor, info contextinfo.ContextInfo) {
+	container := info.ServiceName
+
+	if info.Color != "" {
+		container += "-" + info.Color
+	}
+
+	b, _ := executor.Run(ctx, "sudo docker logs --tail 50 "+info.Quote(container)+" 2>&1")
+
+	rendering.Warning("Last log lines from '%s':", container)
+	rendering.Paragraph(string(b))
+}
+
+/*
+transferApplicationImage builds the Docker image locally and gets it onto
+the server, either by uploading a tarball or through a registry.
+*/
+func transferApplicationImage(ctx context.Context, executor sshutils.Executor, proj *project.PusherProject, info contextinfo.ContextInfo, debug bool) error {
+	var (
+		err      error
+		tunnel   *sshutils.Tunnel
+		platform string
+	)
+
+	if platform, err = buildPlatform(ctx, executor, proj, info); err != nil {
+		rendering.Error("%s", err.Error())
+		return err
+	}
+
+	localCommand := func(command, description string) local.LocalCommand {
+		return local.LocalCommand{
+			Command:            command,
+			CommandDescription: description,
+			Debug:              debug,
+			DryRun:             info.DryRun,
+			ServiceName:        proj.ServiceName,
+			Host:               proj.Host,
+			ImageTag:           info.ImageTag,
+			Registry:           info.Registry,
+			Dockerfile:         proj.Docker.Dockerfile,
+			Context:            proj.Docker.GetContext(),
+			Target:             proj.Docker.Target,
+			BuildArgs:          proj.Docker.BuildArgs(false),
+			Secrets:            proj.Docker.SecretSpecs(),
+			Platform:           platform,
+			Env:                proj.Docker.BuildEnv(),
+		}
+	}
+
+	if proj.UsesRemoteBuild() {
+		return buildApplicationOnServer(ctx, executor, proj, platform, info, debug)
+	}
+
+	local.RunLocalCommand(localCommand(local.BuildDockerImageCommand, "Build Docker Image"))
+
+	if !proj.UsesRegistry() {
+		if local.IsCompressed(proj.Compression) && !proj.UsesLayerTransfer() {
+			return streamApplicationImage(ctx, executor, proj.Compression, info, debug)
+		}
+
+		local.RunLocalCommand(localCommand(local.SaveDockerImageCommand, "Save Docker Image"))
+
+		if proj.UsesLayerTransfer() {
+			if err = reduceApplicationImage(ctx, executor, info); err != nil {
+				rendering.Error("%s", err.Error())
+				return err
+			}
+		}
+
+		if err = uploadApplicationImage(ctx, executor, info, debug); err != nil {
+			return err
+		}
+
+		if proj.UsesLayerTransfer() {
+			if err = commands.ReassembleDockerApplicationCommand.Run(ctx, executor, info, debug); err != nil {
+				return err
+			}
+		}
+
+		if err = commands.LoadDockerApplicationCommand.Run(ctx, executor, info, debug); err != nil {
+			return err
+		}
+
+		return commands.CleanupApplicationCommand.Run(ctx, executor, info, debug)
+	}
+
+	/*
+	 * Push to the registry, then have the server pull. A registry on the
+	 * server is reached through an SSH tunnel to a free local port.
+	 */
+	push := localCommand(local.PushDockerImageCommand, "Push Docker Image")
+	push.Registry = proj.Registry.Address
+	info.Registry = proj.RegistryPullAddress()
+
+	if proj.Registry.Local {
+		if err = commands.SetupServiceRegistryCommand.Run(ctx, executor, info, debug); err != nil {
+			return err
+		}
+
+		push.Registry = "localhost:<tunnel port>"
+
+		if !info.DryRun {
+			gophExecutor, ok := executor.(*sshutils.GophExecutor)
+
+			if !ok {
+				err = fmt.Errorf("Pushing to the registry on the server needs an SSH connection to tunnel through")
+				rendering.Error("%s", err.Error())
+				return err
+			}
+
+			if tunnel, err = sshutils.OpenTunnel(gophExecutor.Client, "127.0.0.1:0", project.LocalRegistryAddress); err != nil {
+				rendering.Error("%s", err.Error())
+				return err
+			}
+
+			defer tunnel.Close()
+			push.Registry = fmt.Sprintf("localhost:%d", tunnel.LocalPort())
+		}
+	}
+
+	local.RunLocalCommand(push)
+
+	return commands.PullDockerApplicationCommand.Run(ctx, executor, info, debug)
+}
+
+/*
+reduceApplicationImage removes the layers the server already has from
+the locally saved image archive.
+*/
+func reduceApplicationImage(ctx context.Context, executor sshutils.Executor, info contextinfo.ContextInfo) error {
+	var (
+		err          error
+		b            []byte
+		remoteLayers []string
+		skipped      int64
+	)
+
+	if info.DryRun {
+		rendering.Print("# Local: Remove layers the server already has from %s-latest.tar", info.ServiceName)
+		rendering.Print("%s", info.ExpandCommand(remoteImageLayersCommand))
+		rendering.BlankLine()
+		return nil
+	}
+
+	spinner := rendering.Spinner("Comparing image layers with the server...")
+
+	if b, err = executor.Run(ctx, info.ExpandCommand(remoteImageLayersCommand)); err != nil {
+		spinner.Fail("Unable to read image layers from the server")
+		return fmt.Errorf("Unable to read image layers from the server: %s", err.Error())
+	}
+
+	if err = json.Unmarshal(bytes.TrimSpace(b), &remoteLayers); err != nil {
+		spinner.Fail("Unable to read image layers from the server")
+		return fmt.Errorf("Unable to read image layers from the server: %s", err.Error())
+	}
+
+	if skipped, err = local.ReduceImageArchive(info.ServiceName+"-latest.tar", remoteLayers); err != nil {
+		spinner.Fail("Unable to remove existing layers from the image")
+		return err
+	}
+
+	spinner.Success(fmt.Sprintf("Skipping %.1f MB of layers already on the server.", float64(skipped)/1024/1024))
+	return nil
+}
+
+const remoteImageLayersCommand = `docker image inspect {{.ServiceName}}:latest --format '{{"{{json .RootFS.Layers}}"}}' 2>/dev/null || echo '[]'`
+
+/*
+uploadApplicationImage uploads the saved image archive over SFTP, then
+removes the local copy.
+*/
+func uploadApplicationImage(ctx context.Context, executor sshutils.Executor, info contextinfo.ContextInfo, debug bool) error {
+	var (
+		err error
+	)
+
+	archive := info.ServiceName + "-latest.tar"
+
+	upload := sshutils.FileUpload{
+		LocalPath:   archive,
+		RemotePath:  "applications/{{.ServiceName}}/{{.ServiceName}}-latest.tar",
+		Description: "Uploading Docker image",
+		Progress:    true,
+		Resume:      true,
+		Verify:      true,
+	}
+
+	if err = upload.Run(ctx, executor, info, debug); err != nil {
+		return err
+	}
+
+	if !info.DryRun {
+		_ = os.Remove(archive)
+	}
+
+	return nil
+}
+
+/*
+streamApplicationImage pipes `docker save` through a compressor straight
+into `docker load` on the server, without writing the image to disk on
+either machine.
+*/
+func streamApplicationImage(ctx context.Context, executor sshutils.Executor, compression string, info contextinfo.ContextInfo, debug bool) error {
+	var (
+		err        error
+		stdout     io.ReadCloser
+		compressor io.WriteCloser
+		output     []byte
+		stderr     bytes.Buffer
+	)
+
+	/*
+	 * Servers prepared before zstd was part of the base packages don't
+	 * have it, and the stream would only fail once it reached them.
+	 */
+	if compression == local.CompressionZstd && !info.DryRun {
+		if _, err = executor.Run(ctx, "command -v zstd"); err != nil {
+			rendering.Warning("The server doesn't have zstd installed, so the image is sent with gzip instead. Run 'pusher prepare' to install it.")
+			compression = local.CompressionGzip
+		}
+	}
+
+	images := []string{info.ServiceName + ":latest", info.ServiceName + ":" + info.ImageTag}
+	loadCommand := local.DecompressCommand(compression) + " | docker load"
+
+	if info.DryRun {
+		rendering.Print("# Stream: Docker image (%s)", compression)
+		rendering.Print("docker save %s | %s | ssh %s '%s'", strings.Join(images, " "), compression, info.HostName, loadCommand)
+		rendering.BlankLine()
+		return nil
+	}
+
+	spinner := rendering.Spinner("Streaming Docker image to the server...")
+
+	save := exec.Command("docker", append([]string{"save"}, images...)...)
+	save.Stderr = &stderr
+
+	if stdout, err = save.StdoutPipe(); err != nil {
+		spinner.Fail(fmt.Sprintf("Unable to run docker save: %s", err.Error()))
+		return err
+	}
+
+	if err = save.Start(); err != nil {
+		spinner.Fail(fmt.Sprintf("Unable to run docker save: %s", err.Error()))
+		return err
+	}
+
+	reader, writer := io.Pipe()
+
+	if compressor, err = local.NewCompressor(writer, compression); err != nil {
+		spinner.Fail(err.Error())
+		_ = save.Process.Kill()
+		return err
+	}
+
+	go func() {
+		counter := &byteCounter{onWrite: func(total int64) {
+			spinner.UpdateText(fmt.Sprintf("Streaming Docker image to the server (%.1f MB saved)...", float64(total)/1024/1024))
+		}}
+
+		_, copyErr := io.Copy(compressor, io.TeeReader(stdout, counter))
+
+		if closeErr := compressor.Close(); copyErr == nil {
+			copyErr = closeErr
+		}
+
+		if waitErr := save.Wait(); copyErr == nil && waitErr != nil {
+			copyErr = fmt.Errorf("docker save failed: %s %s", waitErr.Error(), stderr.String())
+		}
+
+		writer.CloseWithError(copyErr)
+	}()
+
+	output, err = sshutils.Stream(ctx, executor, info, loadCommand, reader, debug)
+	_ = reader.Close()
+
+	if err != nil {
+		spinner.Fail(fmt.Sprintf("There was a problem streaming your application to the server: %s", err.Error()))
+		rendering.Paragraph(string(output))
+		return err
+	}
+
+	if debug {
+		rendering.Paragraph("DEBUG: %s", string(output))
+	}
+
+	spinner.Success("Docker image streamed and loaded.")
+	return nil
+}
+
+/*
+byteCounter counts the bytes written to it, and reports the running
+total at most twice a second.
+*/
+type byteCounter struct {
+	total      int64
+	lastReport time.Time
+	onWrite    func(total int64)
+}
+
+func (c *byteCounter) Write(b []byte) (int, error) {
+	c.total += int64(len(b))
+
+	if time.Since(c.lastReport) > 500*time.Millisecond {
+		c.lastReport = time.Now()
+		c.onWrite(c.total)
+	}
+
+	return len(b), nil
+}
+
+/*
+buildApplicationOnServer syncs the build context to the server and runs
+`docker build` there, so there is no image to save, upload, or load.
+*/
+func buildApplicationOnServer(ctx context.Context, executor sshutils.Executor, proj *project.PusherProject, platform string, info contextinfo.ContextInfo, debug bool) error {
+	var (
+		err        error
+		output     []byte
+		dockerfile string
+	)
+
+	buildContext := proj.Docker.GetContext()
+
+	/*
+	 * Only the build context is copied to the server, so the Dockerfile
+	 * has to live inside it, and secrets can't be read from local files.
+	 */
+	if len(proj.Docker.Secrets) > 0 {
+		err = fmt.Errorf("Build secrets are not supported with 'build: %s'", project.BuildRemote)
+		rendering.Error("%s", err.Error())
+		return err
+	}
+
+	if proj.Docker.Dockerfile != "" {
+		dockerfile, err = filepath.Rel(buildContext, proj.Docker.Dockerfile)
+
+		if err != nil || strings.HasPrefix(dockerfile, "..") {
+			err = fmt.Errorf("The Dockerfile '%s' must be inside the build context '%s' with 'build: %s'", proj.Docker.Dockerfile, buildContext, project.BuildRemote)
+			rendering.Error("%s", err.Error())
+			return err
+		}
+	}
+
+	info.DockerBuild = contextinfo.DockerBuildInfo{
+		Dockerfile: filepath.ToSlash(dockerfile),
+		Target:     proj.Docker.Target,
+		BuildArgs:  proj.Docker.BuildArgs(true),
+		Platform:   platform,
+	}
+
+	if info.DryRun {
+		rendering.Print("# Stream: Build context (honoring .dockerignore)")
+		rendering.Print("tar -cz %s | ssh %s '%s'", buildContext, info.HostName, info.ExpandCommand(commands.SyncBuildContextCommand))
+		rendering.BlankLine()
+
+		return commands.RemoteBuildApplicationCommand.Run(ctx, executor, info, debug)
+	}
+
+	spinner := rendering.Spinner("Syncing build context to the server...")
+	reader, writer := io.Pipe()
+
+	go func() {
+		writer.CloseWithError(local.WriteBuildContext(writer, buildContext, dockerfile))
+	}()
+
+	output, err = sshutils.Stream(ctx, executor, info, commands.SyncBuildContextCommand, reader, debug)
+	_ = reader.Close()
+
+	if err != nil {
+		spinner.Fail(fmt.Sprintf("There was a problem syncing the build context: %s", err.Error()))
+		rendering.Paragraph(string(output))
+		return err
+	}
+
+	spinner.Success("Build context synced.")
+	return commands.RemoteBuildApplicationCommand.Run(ctx, executor, info, debug)
+}
+
+/*
+buildPlatform returns the platform to build the image for. When it isn't
+configured it is detected from the server's architecture.
+*/
+func buildPlatform(ctx context.Context, executor sshutils.Executor, proj *project.PusherProject, info contextinfo.ContextInfo) (string, error) {
+	if proj.Docker.Platform != "" {
+		return proj.Docker.Platform, nil
+	}
+
+	if info.DryRun {
+		return project.PlatformFromArch(""), nil
+	}
+
+	b, err := executor.Run(ctx, "uname -m")
+
+	if err != nil {
+		return "", fmt.Errorf("Unable to detect the server's architecture: %s", err.Error())
+	}
+
+	return project.PlatformFromArch(string(b)), nil
+}
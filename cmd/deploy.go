@@ -22,12 +22,10 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"strconv"
-	"strings"
 
 	"github.com/adampresley/pusher/pkg/commands"
 	"github.com/adampresley/pusher/pkg/contextinfo"
@@ -35,6 +33,7 @@ import (
 	"github.com/adampresley/pusher/pkg/project"
 	"github.com/adampresley/pusher/pkg/rendering"
 	"github.com/adampresley/pusher/pkg/sshutils"
+	"github.com/adampresley/pusher/pkg/validation"
 	"github.com/melbahja/goph"
 	"github.com/pterm/pterm"
 	"github.com/spf13/cobra"
@@ -48,16 +47,17 @@ var deployCmd = &cobra.Command{
 deploy it to your server, and increment the deploy version.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		var (
-			err                error
-			port               string
-			sshClient          *goph.Client
-			contextInfo        contextinfo.ContextInfo
-			changeDependencies bool
-			dependencies       []string
-			changeMounts       bool
+			err             error
+			sshClient       *goph.Client
+			contextInfo     contextinfo.ContextInfo
+			envFileContents []byte
 		)
 
 		debug, _ := cmd.Flags().GetBool("debug")
+		summary := sshutils.NewRunSummary()
+		ctx := sshutils.WithRunSummary(cmd.Context(), summary)
+		nonInteractive := isNonInteractive(cmd)
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
 
 		if debug {
 			rendering.Print("Debug enabled.")
@@ -68,264 +68,418 @@ deploy it to your server, and increment the deploy version.`,
 		/*
 		 * First load the project
 		 */
-		proj := &project.PusherProject{}
+		proj, err := loadProject(cmd)
 
-		if err = proj.Load(); err != nil {
+		if err != nil {
 			rendering.Error("There was a problem loading your project configuration file: %s", err.Error())
 			os.Exit(1)
 		}
 
 		/*
-		 * Gather data
+		 * Apply any values passed as flags or environment variables,
+		 * then either validate them or prompt for the rest.
 		 */
-	enterservicename:
-		proj.ServiceName, _ = pterm.DefaultInteractiveTextInput.
-			WithDefaultValue(proj.ServiceName).
-			Show("Enter app name (directory and Docker friendly)")
-
-		if proj.ServiceName == "" || strings.Contains(proj.ServiceName, " ") {
-			rendering.Error("App name must not be empty of contain spaces.")
-			goto enterservicename
+		if err = applyDeployOptions(cmd, proj); err != nil {
+			rendering.Error("%s", err.Error())
+			os.Exit(1)
 		}
 
-	enterport:
-		port, _ = pterm.DefaultInteractiveTextInput.
-			WithDefaultValue(strconv.Itoa(proj.Port)).
-			Show("enter the port number your app binds to")
-
-		if proj.Port, err = strconv.Atoi(port); err != nil {
-			rendering.Error("Port must be a valid integer.")
-			goto enterport
+		if nonInteractive {
+			if err = validateDeploySettings(proj); err != nil {
+				rendering.Error("%s", err.Error())
+				os.Exit(1)
+			}
+		} else {
+			promptForDeploySettings(proj)
 		}
 
-		if proj.Port == 80 || proj.Port == 443 || proj.Port == 8080 {
-			rendering.Error("Ports 80, 443, and 8080 are taken.")
-			goto enterport
+		if proj.UsesRegistry() && !proj.Registry.Local && proj.Registry.Address == "" {
+			rendering.Error("'transfer: registry' needs either 'registry.address' or 'registry.local: true' in %s", project.PusherProjectFileName)
+			os.Exit(1)
 		}
 
-		proj.Domain, _ = pterm.DefaultInteractiveTextInput.
-			WithDefaultValue(proj.Domain).
-			Show("Enter the domain (URL) to your app")
+		if local.IsCompressed(proj.Compression) && proj.Compression != local.CompressionGzip && proj.Compression != local.CompressionZstd {
+			rendering.Error("Unknown compression '%s' in %s. Use '%s', '%s' or '%s'", proj.Compression, project.PusherProjectFileName, local.CompressionGzip, local.CompressionZstd, local.CompressionOff)
+			os.Exit(1)
+		}
 
-		if proj.EnvFile == "" {
-			proj.EnvFile = ".env"
+		/*
+		 * Read and validate the env file now, decrypting it if needed,
+		 * so a missing file, key, or variable stops the deploy before
+		 * anything is built.
+		 */
+		if envFileContents, err = readLocalEnvFile(proj); err != nil {
+			rendering.Error("%s", err.Error())
+			os.Exit(1)
 		}
 
-		proj.EnvFile, _ = pterm.DefaultInteractiveTextInput.
-			WithDefaultValue(proj.EnvFile).
-			Show("Enter an env file containing your app settings")
+		if err = validateEnvFile(proj, envFileContents); err != nil {
+			rendering.Error("%s", err.Error())
+			os.Exit(1)
+		}
 
 		/*
-		 * If we've already stored dependencies, ask the user if they
-		 * want to keep the same list, or make a new one.
+		 * SAVE!
 		 */
-		if len(proj.Dependencies) > 0 {
-			changeDependencies, _ = pterm.DefaultInteractiveConfirm.
-				WithDefaultValue(false).
-				Show("You already have dependencies defined for this project. Would you like to change them?")
+		if !dryRun {
+			if err = proj.Save(); err != nil {
+				rendering.Error("There was a problem saving your project settings: %s", err.Error())
+				os.Exit(1)
+			}
 		}
 
-		if changeDependencies || len(proj.Dependencies) <= 0 {
-		addmoredependencies:
-			newDependency, _ := pterm.DefaultInteractiveTextInput.
-				Show("Enter the name of a dependency (blank to finish)")
+		/*
+		 * Get an SSH client and start deploying. A dry run only
+		 * needs the host details from the SSH config.
+		 */
+		if dryRun {
+			if contextInfo, err = sshutils.GetHostInfoFromProject(proj); err != nil {
+				rendering.Error("Unable to read SSH config for host '%s': %s", proj.Host, err.Error())
+				os.Exit(1)
+			}
 
-			if newDependency != "" {
-				dependencies = append(dependencies, newDependency)
-				goto addmoredependencies
+			contextInfo.DryRun = true
+			rendering.Warning("Dry run. Nothing will be run locally or on '%s'.", proj.Host)
+			rendering.BlankLine()
+		} else {
+			spinner := rendering.Spinner(fmt.Sprintf("Getting SSH client for host '%s'", proj.Host))
+
+			if sshClient, contextInfo, err = sshutils.GetClientFromProject(proj); err != nil {
+				spinner.Fail(fmt.Sprintf("Unable to get SSH client for host '%s': %s", proj.Host, err.Error()))
+				os.Exit(1)
 			}
-		}
 
-		proj.Dependencies = dependencies
+			defer sshClient.Close()
+			spinner.Success("Connection established.")
+		}
 
 		/*
-		 * Manage mounts
+		 * Setup the app on the server
 		 */
-		if len(proj.Mounts) > 0 {
-			changeMounts, _ = pterm.DefaultInteractiveConfirm.
-				WithDefaultValue(false).
-				Show("You already have mounts defined for this project. Would you like to manage them?")
+		contextInfo.ImageTag = strconv.Itoa(proj.NextVersion())
+
+		if err = deployApplication(ctx, sshutils.NewGophExecutor(sshClient), proj, contextInfo, envFileContents, debug); err != nil {
+			summary.Print()
+			os.Exit(1)
 		}
 
-		if changeMounts || len(proj.Mounts) <= 0 {
-			mountActions := []string{
-				"Add mount",
-				"Remove mount",
-				"Done",
-			}
+		summary.Print()
 
-		keepmanagingmounts:
-			mountOptions := proj.Mounts.ToStrings()
+		if dryRun {
+			rendering.Success("Dry run complete. Version %d would be deployed.", proj.NextVersion())
+			return
+		}
 
-			selectedMountAction, _ := pterm.DefaultInteractiveSelect.
-				WithOptions(mountActions).
-				WithDefaultText("What would you like to do?").
-				Show()
+		/*
+		 * Update the project file version and date
+		 */
+		if err = proj.UpdateVersionAndDate(); err != nil {
+			rendering.Error("Your application was deployed, but there was a problem updating the local project file: %s", err)
+			os.Exit(1)
+		}
+
+		rendering.Header("🚀 Version %d deployed!", proj.Version)
+	},
+}
+
+/*
+deployApplication does everything a deploy does on the server: it sets up
+the application's folder and env file, gets the image there, starts it,
+and prunes old images. info.ImageTag must be the version being deployed.
+*/
+func deployApplication(ctx context.Context, executor sshutils.Executor, proj *project.PusherProject, info contextinfo.ContextInfo, envFileContents []byte, debug bool) error {
+	var (
+		err error
+	)
+
+	if err = resolveColors(ctx, executor, proj, &info); err != nil {
+		rendering.Error("%s", err.Error())
+		return err
+	}
+
+	if debug {
+		rendering.Print("context: %+v", info)
+	}
+
+	/*
+	 * Upload the env file and docker-compose
+	 */
+	if err = commands.SetupApplicationCommand.Run(ctx, executor, info, debug); err != nil {
+		return err
+	}
+
+	uploadEnvFile := sshutils.FileUpload{
+		Contents:    envFileContents,
+		RemotePath:  "applications/{{.ServiceName}}/{{.EnvFile}}",
+		Description: "Uploading env file",
+	}
+
+	if err = uploadEnvFile.Run(ctx, executor, info, debug); err != nil {
+		return err
+	}
+
+	/*
+	 * Create any missing mount folders on the server.
+	 */
+	if len(proj.Mounts) > 0 {
+		if err = commands.CreateMountDirectoriesCommand.Run(ctx, executor, info, debug); err != nil {
+			return err
+		}
+	}
 
-			switch selectedMountAction {
-			case "Add mount":
-				newMountLocal, _ := pterm.DefaultInteractiveTextInput.
-					Show("Enter local mount path")
+	/*
+	 * Build docker image and get it to the server.
+	 */
+	if err = transferApplicationImage(ctx, executor, proj, info, debug); err != nil {
+		return err
+	}
 
-				newMountRemote, _ := pterm.DefaultInteractiveTextInput.
-					Show("Enter remote mount path")
+	if err = startApplication(ctx, executor, proj, info, debug); err != nil {
+		return err
+	}
 
-				newMount := project.Mount{
-					Local:  newMountLocal,
-					Remote: newMountRemote,
-				}
+	return commands.PruneApplicationImagesCommand.Run(ctx, executor, info, debug)
+}
 
-				proj.Mounts = append(proj.Mounts, newMount)
+/*
+applyDeployOptions overrides project settings with any values passed
+as flags or environment variables.
+*/
+func applyDeployOptions(cmd *cobra.Command, proj *project.PusherProject) error {
+	var (
+		err error
+	)
+
+	if value, ok := stringOption(cmd, "host"); ok {
+		proj.Host = value
+	}
+
+	if value, ok := stringOption(cmd, "service-name"); ok {
+		proj.ServiceName = value
+	}
+
+	if value, ok := stringOption(cmd, "port"); ok {
+		if proj.Port, err = strconv.Atoi(value); err != nil {
+			return fmt.Errorf("Port must be a valid integer, got '%s'", value)
+		}
+	}
 
-				rendering.Success("Mount added.")
-				goto keepmanagingmounts
+	if value, ok := stringOption(cmd, "domain"); ok {
+		proj.Domain = value
+	}
 
-			case "Remove mount":
-				selectedMountString, _ := pterm.DefaultInteractiveSelect.
-					WithOptions(mountOptions).
-					Show()
+	if value, ok := stringOption(cmd, "env-file"); ok {
+		proj.EnvFile = value
+	}
 
-				newMounts := project.Mounts{}
+	if values, ok := stringSliceOption(cmd, "dependency"); ok {
+		proj.Dependencies = values
+	}
 
-				for _, m := range proj.Mounts {
-					if m.String() != selectedMountString {
-						newMounts = append(newMounts, m)
-					}
-				}
+	if values, ok := stringSliceOption(cmd, "mount"); ok {
+		mounts := project.Mounts{}
 
-				rendering.Success("Mount removed.")
-				goto keepmanagingmounts
+		for _, v := range values {
+			m, err := project.ParseMount(v)
 
-			default:
-				// We are done. Just keep going
+			if err != nil {
+				return err
 			}
-		}
 
-		/*
-		 * SAVE!
-		 */
-		if err = proj.Save(); err != nil {
-			rendering.Error("There was a problem saving your project settings: %s", err.Error())
-			os.Exit(1)
+			mounts = append(mounts, m)
 		}
 
-		/*
-		 * Get an SSH client and start deploying.
-		 */
-		spinner := rendering.Spinner(fmt.Sprintf("Getting SSH client for host '%s'", proj.Host))
+		proj.Mounts = mounts
+	}
 
-		if sshClient, contextInfo, err = sshutils.GetClientFromProject(proj); err != nil {
-			spinner.Fail(fmt.Sprintf("Unable to get SSH client for host '%s': %s", proj.Host, err.Error()))
-			os.Exit(1)
-		}
+	return nil
+}
 
-		defer sshClient.Close()
-		spinner.Success("Connection established.")
+/*
+validateDeploySettings makes sure every value needed to deploy is present
+and valid. This is used in non-interactive mode in place of prompting.
+*/
+func validateDeploySettings(proj *project.PusherProject) error {
+	if proj.Host == "" {
+		return missingOptionError("host", "host")
+	}
 
-		/*
-		 * Setup the app on the server
-		 */
-		contextInfo.ServiceName = proj.ServiceName
-		contextInfo.Port = port
-		contextInfo.Domain = proj.Domain
-		contextInfo.EnvFile = proj.EnvFile
-		contextInfo.Dependencies = proj.Dependencies
-		contextInfo.Mounts = proj.Mounts.ToStrings()
+	if proj.ServiceName == "" {
+		return missingOptionError("service-name", "servicename")
+	}
 
-		if debug {
-			rendering.Print("context: %+v", contextInfo)
-		}
+	if !validation.IsValidServiceName(proj.ServiceName) {
+		return fmt.Errorf("App name '%s' must not be empty or contain spaces.", proj.ServiceName)
+	}
 
-		cwd, _ := os.Getwd()
-		baseEnvFileName := filepath.Base(proj.EnvFile)
-		envFileName := filepath.Join(cwd, baseEnvFileName)
+	if proj.Port == 0 {
+		return missingOptionError("port", "port")
+	}
 
-		if debug {
-			rendering.Print("local env: %s (base '%s')", envFileName, baseEnvFileName)
-		}
+	if validation.IsReservedPort(proj.Port) {
+		return fmt.Errorf("Ports 80, 443, and 8080 are taken.")
+	}
 
-		/*
-		 * Upload the env file and docker-compose
-		 */
-		if err = commands.SetupApplicationCommand.Run(sshClient, contextInfo, debug); err != nil {
-			os.Exit(1)
+	if proj.Domain == "" {
+		return missingOptionError("domain", "domain")
+	}
+
+	if proj.EnvFile == "" {
+		proj.EnvFile = ".env"
+	}
+
+	return nil
+}
+
+/*
+promptForDeploySettings asks the user for each deploy setting, using the
+current project values as defaults.
+*/
+func promptForDeploySettings(proj *project.PusherProject) {
+	var (
+		err                error
+		port               string
+		changeDependencies bool
+		dependencies       []string
+		changeMounts       bool
+	)
+
+enterservicename:
+	proj.ServiceName, _ = pterm.DefaultInteractiveTextInput.
+		WithDefaultValue(proj.ServiceName).
+		Show("Enter app name (directory and Docker friendly)")
+
+	if !validation.IsValidServiceName(proj.ServiceName) {
+		rendering.Error("App name must not be empty of contain spaces.")
+		goto enterservicename
+	}
+
+enterport:
+	port, _ = pterm.DefaultInteractiveTextInput.
+		WithDefaultValue(strconv.Itoa(proj.Port)).
+		Show("enter the port number your app binds to")
+
+	if proj.Port, err = strconv.Atoi(port); err != nil {
+		rendering.Error("Port must be a valid integer.")
+		goto enterport
+	}
+
+	if validation.IsReservedPort(proj.Port) {
+		rendering.Error("Ports 80, 443, and 8080 are taken.")
+		goto enterport
+	}
+
+	proj.Domain, _ = pterm.DefaultInteractiveTextInput.
+		WithDefaultValue(proj.Domain).
+		Show("Enter the domain (URL) to your app")
+
+	if proj.EnvFile == "" {
+		proj.EnvFile = ".env"
+	}
+
+	proj.EnvFile, _ = pterm.DefaultInteractiveTextInput.
+		WithDefaultValue(proj.EnvFile).
+		Show("Enter an env file containing your app settings")
+
+	/*
+	 * If we've already stored dependencies, ask the user if they
+	 * want to keep the same list, or make a new one.
+	 */
+	if len(proj.Dependencies) > 0 {
+		changeDependencies, _ = pterm.DefaultInteractiveConfirm.
+			WithDefaultValue(false).
+			Show("You already have dependencies defined for this project. Would you like to change them?")
+	}
+
+	if changeDependencies || len(proj.Dependencies) <= 0 {
+	addmoredependencies:
+		newDependency, _ := pterm.DefaultInteractiveTextInput.
+			Show("Enter the name of a dependency (blank to finish)")
+
+		if newDependency != "" {
+			dependencies = append(dependencies, newDependency)
+			goto addmoredependencies
 		}
 
-		/*
-		 * Upload env file
-		 */
-		uploadCmd := exec.Command("scp", envFileName, fmt.Sprintf("%s:~/applications/%s/%s", proj.Host, proj.ServiceName, baseEnvFileName))
-		if err = uploadCmd.Run(); err != nil {
-			rendering.Error("Unable to upload env file '%s': %s", envFileName, err.Error())
-			os.Exit(1)
+		proj.Dependencies = dependencies
+	}
+
+	/*
+	 * Manage mounts
+	 */
+	if len(proj.Mounts) > 0 {
+		changeMounts, _ = pterm.DefaultInteractiveConfirm.
+			WithDefaultValue(false).
+			Show("You already have mounts defined for this project. Would you like to manage them?")
+	}
+
+	if changeMounts || len(proj.Mounts) <= 0 {
+		mountActions := []string{
+			"Add mount",
+			"Remove mount",
+			"Done",
 		}
 
-		/*
-		 * Create any missing mount folders on the server.
-		 */
-		for _, m := range proj.Mounts {
-			createResult, err := sshClient.Run("mkdir -p " + m.Local)
+	keepmanagingmounts:
+		mountOptions := proj.Mounts.ToStrings()
 
-			if err != nil {
-				rendering.Error("Unable to create local mount folder on the server: %s", err.Error())
-				rendering.Print("Folder: %s", m.Local)
+		selectedMountAction, _ := pterm.DefaultInteractiveSelect.
+			WithOptions(mountActions).
+			WithDefaultText("What would you like to do?").
+			Show()
 
-				os.Exit(1)
-			}
+		switch selectedMountAction {
+		case "Add mount":
+			newMountLocal, _ := pterm.DefaultInteractiveTextInput.
+				Show("Enter local mount path")
 
-			if debug {
-				rendering.Print("response: %s", string(createResult))
+			newMountRemote, _ := pterm.DefaultInteractiveTextInput.
+				Show("Enter remote mount path")
+
+			newMount := project.Mount{
+				Local:  newMountLocal,
+				Remote: newMountRemote,
 			}
-		}
 
-		/*
-		 * Build docker image and copy it to the server.
-		 */
-		buildDockerImageCmd := local.LocalCommand{
-			Command:            local.BuildDockerImageCommand,
-			CommandDescription: "Build Docker Image",
-			Debug:              debug,
-			ServiceName:        proj.ServiceName,
-			Host:               proj.Host,
-		}
+			proj.Mounts = append(proj.Mounts, newMount)
 
-		local.RunLocalCommand(buildDockerImageCmd)
+			rendering.Success("Mount added.")
+			goto keepmanagingmounts
 
-		copyDockerImageCmd := local.LocalCommand{
-			Command:            local.UploadDockerImageCommand,
-			CommandDescription: "Upload Docker Image",
-			Debug:              debug,
-			ServiceName:        proj.ServiceName,
-			Host:               proj.Host,
-		}
+		case "Remove mount":
+			selectedMountString, _ := pterm.DefaultInteractiveSelect.
+				WithOptions(mountOptions).
+				Show()
 
-		local.RunLocalCommand(copyDockerImageCmd)
+			newMounts := project.Mounts{}
 
-		if err = commands.LoadDockerApplicationCommand.Run(sshClient, contextInfo, debug); err != nil {
-			os.Exit(1)
-		}
+			for _, m := range proj.Mounts {
+				if m.String() != selectedMountString {
+					newMounts = append(newMounts, m)
+				}
+			}
 
-		if err = commands.StartApplicationCommand.Run(sshClient, contextInfo, debug); err != nil {
-			os.Exit(1)
-		}
+			proj.Mounts = newMounts
 
-		if err = commands.CleanupApplicationCommand.Run(sshClient, contextInfo, debug); err != nil {
-			os.Exit(1)
-		}
+			rendering.Success("Mount removed.")
+			goto keepmanagingmounts
 
-		/*
-		 * Update the project file version and date
-		 */
-		if err = proj.UpdateVersionAndDate(); err != nil {
-			rendering.Error("Your application was deployed, but there was a problem updating the local project file: %s", err)
-			os.Exit(1)
+		default:
+			// We are done. Just keep going
 		}
-
-		rendering.Header("🚀 Version %d deployed!", proj.Version)
-	},
+	}
 }
 
 func init() {
 	deployCmd.Flags().BoolP("debug", "d", false, "Enable debug output")
+	deployCmd.Flags().Bool("dry-run", false, "Print every command and generated file without connecting to the server or running Docker")
+	addNonInteractiveFlags(deployCmd)
+	deployCmd.Flags().String("host", "", "SSH config host to deploy to")
+	deployCmd.Flags().String("service-name", "", "App name (directory and Docker friendly)")
+	deployCmd.Flags().String("port", "", "Port number your app binds to")
+	deployCmd.Flags().String("domain", "", "Domain (URL) to your app")
+	deployCmd.Flags().String("env-file", "", "Env file containing your app settings")
+	deployCmd.Flags().StringArray("mount", nil, "Volume mount in the form 'local:remote'. May be repeated")
+	deployCmd.Flags().StringArray("dependency", nil, "Name of a dependency. May be repeated")
 	rootCmd.AddCommand(deployCmd)
 }
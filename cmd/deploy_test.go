@@ -0,0 +1,376 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adampresley/pusher/pkg/commands"
+	"github.com/adampresley/pusher/pkg/contextinfo"
+	"github.com/adampresley/pusher/pkg/project"
+	"github.com/adampresley/pusher/pkg/sshtest"
+	"github.com/adampresley/pusher/pkg/sshutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeployApplicationBuildsOnServer(t *testing.T) {
+	proj := newTestProject(t)
+	info := newTestContext(proj)
+
+	server := sshtest.NewServer(t)
+	server.Handler = func(command string, stdin []byte) (string, int) {
+		if command == "uname -m" {
+			return "aarch64\n", 0
+		}
+
+		return "", 0
+	}
+
+	err := deployApplication(context.Background(), sshutils.NewGophExecutor(server.Dial(t)), proj, info, []byte("SECRET=1\n"), false)
+	assert.NoError(t, err)
+
+	want := stepCommands(info, &commands.SetupApplicationCommand)
+	want = append(want,
+		"uname -m",
+		"rm -rf ~/applications/myapp/src && mkdir -p ~/applications/myapp/src && tar -xzf - -C ~/applications/myapp/src",
+		"cd ~/applications/myapp/src && docker build --cache-from=myapp:latest --tag myapp:latest --tag myapp:3 --platform linux/arm64 .",
+		"cd applications/myapp && sudo docker compose up -d",
+	)
+	want = append(want, stepCommands(info, &commands.PruneApplicationImagesCommand)...)
+
+	assert.Equal(t, want, server.Commands())
+
+	envFile, found := server.File("applications/myapp/.env")
+	assert.True(t, found)
+	assert.Equal(t, "SECRET=1\n", string(envFile))
+
+	assert.Equal(t, []string{"Dockerfile"}, tarNames(t, server.Execs()[3].Stdin))
+}
+
+func TestDeployApplicationBlueGreen(t *testing.T) {
+	proj := newTestProject(t)
+	proj.DeployMode = project.DeployModeBlueGreen
+	proj.Docker.Platform = "linux/amd64"
+
+	recorder := &sshtest.Recorder{
+		Handler: func(command string, stdin []byte) (string, int) {
+			if strings.HasPrefix(command, "cat ~/applications/myapp/.active-color") {
+				return "blue\n", 0
+			}
+
+			return "", 0
+		},
+	}
+
+	err := deployApplication(context.Background(), recorder, proj, newTestContext(proj), []byte("SECRET=1\n"), false)
+	assert.NoError(t, err)
+
+	got := recorder.Commands()
+
+	assert.Equal(t, "cat ~/applications/myapp/.active-color 2>/dev/null || true", got[0])
+	assert.Contains(t, got[2], "tee docker-compose.green.yml")
+	assert.Contains(t, got[2], "traefik.enable=false", "the new colour gets no traffic until it passes its checks")
+
+	info := newTestContext(proj)
+	info.Color = "green"
+	route := stepCommands(info, &commands.RouteBlueGreenApplicationCommand)
+	switchColor := stepCommands(info, &commands.SwitchBlueGreenApplicationCommand)
+	routed := indexOf(got, route[0])
+
+	assert.Greater(t, routed, indexOf(got, stepCommands(info, &commands.WaitForBlueGreenApplicationCommand)[0]))
+	assert.Less(t, routed, indexOf(got, switchColor[0]))
+	assert.Contains(t, got, "cd applications/myapp && sudo docker compose -p myapp-green -f docker-compose.green.yml up -d")
+	assert.Contains(t, got, "cd ~/applications/myapp && echo green > .active-color")
+	assert.Contains(t, got, "cd ~/applications/myapp && sudo docker compose -p myapp-blue -f docker-compose.blue.yml down")
+	assert.NotContains(t, got, "uname -m", "a configured platform isn't detected")
+
+	assert.Equal(t, []sshtest.Upload{{RemotePath: "applications/myapp/.env", Contents: []byte("SECRET=1\n")}}, recorder.Uploads())
+}
+
+func TestDeployApplicationBlueGreenFailedHealthCheck(t *testing.T) {
+	proj := newTestProject(t)
+	proj.DeployMode = project.DeployModeBlueGreen
+	proj.Docker.Platform = "linux/amd64"
+	proj.HealthCheck = project.HealthCheck{Path: "/health"}
+
+	recorder := &sshtest.Recorder{
+		Handler: func(command string, stdin []byte) (string, int) {
+			if strings.HasPrefix(command, "cat ~/applications/myapp/.active-color") {
+				return "blue\n", 0
+			}
+
+			if strings.HasPrefix(command, "host=") {
+				return "expected status 200 from /health, got 502", 1
+			}
+
+			return "", 0
+		},
+	}
+
+	err := deployApplication(context.Background(), recorder, proj, newTestContext(proj), []byte("SECRET=1\n"), false)
+	assert.Error(t, err)
+
+	info := newTestContext(proj)
+	info.Color = "green"
+	got := recorder.Commands()
+
+	assert.Equal(t, -1, indexOf(got, stepCommands(info, &commands.RouteBlueGreenApplicationCommand)[0]), "the new colour is never routed")
+	assert.Equal(t, stepCommands(info, &commands.StopBlueGreenApplicationCommand), got[len(got)-1:])
+}
+
+func TestDeployApplicationRestoresOnFailedHealthCheck(t *testing.T) {
+	proj := newTestProject(t)
+	proj.Docker.Platform = "linux/amd64"
+	proj.HealthCheck = project.HealthCheck{Path: "/health"}
+	proj.Version = 2
+	proj.ActiveVersion = 2
+	proj.History = project.Deployments{{Version: 1}, {Version: 2}}
+
+	recorder := &sshtest.Recorder{
+		Handler: func(command string, stdin []byte) (string, int) {
+			if strings.HasPrefix(command, "host=") {
+				return "expected status 200 from /health, got 502", 1
+			}
+
+			return "", 0
+		},
+	}
+
+	info := newTestContext(proj)
+	err := deployApplication(context.Background(), recorder, proj, info, []byte("SECRET=1\n"), false)
+	assert.Error(t, err)
+
+	restored := info
+	restored.ImageTag = "2"
+
+	want := []string{"sudo docker logs --tail 50 'myapp' 2>&1"}
+	want = append(want, stepCommands(restored, &commands.SetupApplicationCommand, &commands.StartApplicationCommand)...)
+
+	got := recorder.Commands()
+	assert.Equal(t, want, got[len(got)-len(want):])
+	assert.Contains(t, got[len(got)-2], "image: myapp:2")
+}
+
+func TestDeployApplicationThroughRegistry(t *testing.T) {
+	proj := newTestProject(t)
+	proj.Build = ""
+	proj.Docker.Platform = "linux/amd64"
+	proj.Transfer = project.TransferRegistry
+	proj.Registry = project.Registry{Address: "registry.example.com"}
+
+	dockerLog := fakeDocker(t)
+	recorder := &sshtest.Recorder{}
+
+	err := deployApplication(context.Background(), recorder, proj, newTestContext(proj), []byte("SECRET=1\n"), false)
+	assert.NoError(t, err)
+
+	local, _ := os.ReadFile(dockerLog)
+	localCommands := strings.Split(strings.TrimSpace(string(local)), "\n")
+
+	assert.True(t, strings.HasPrefix(localCommands[0], "build "))
+	assert.Equal(t, []string{
+		"tag myapp:3 registry.example.com/myapp:3",
+		"push registry.example.com/myapp:3",
+		"rmi registry.example.com/myapp:3",
+	}, localCommands[1:])
+
+	info := newTestContext(proj)
+	info.Registry = "registry.example.com"
+	pull := stepCommands(info, &commands.PullDockerApplicationCommand)
+	got := recorder.Commands()
+
+	assert.Equal(t, []string{
+		"sudo docker pull registry.example.com/myapp:3",
+		"sudo docker tag registry.example.com/myapp:3 myapp:3 && sudo docker tag registry.example.com/myapp:3 myapp:latest && sudo docker rmi registry.example.com/myapp:3",
+	}, pull)
+
+	pulled := indexOf(got, pull[0])
+	assert.NotEqual(t, -1, pulled)
+	assert.Equal(t, pull, got[pulled:pulled+len(pull)])
+	assert.Less(t, pulled, indexOf(got, "cd applications/myapp && sudo docker compose up -d"))
+
+	for _, command := range got {
+		assert.NotContains(t, command, "docker load", "nothing is loaded from a tarball")
+	}
+
+	assert.Equal(t, []sshtest.Upload{{RemotePath: "applications/myapp/.env", Contents: []byte("SECRET=1\n")}}, recorder.Uploads(), "no image tarball is uploaded")
+}
+
+func TestDeployApplicationStartsLocalRegistry(t *testing.T) {
+	proj := newTestProject(t)
+	proj.Build = ""
+	proj.Docker.Platform = "linux/amd64"
+	proj.Transfer = project.TransferRegistry
+	proj.Registry = project.Registry{Local: true}
+
+	fakeDocker(t)
+	recorder := &sshtest.Recorder{}
+
+	err := deployApplication(context.Background(), recorder, proj, newTestContext(proj), []byte("SECRET=1\n"), false)
+	assert.ErrorContains(t, err, "needs an SSH connection to tunnel through")
+
+	info := newTestContext(proj)
+	info.Registry = project.LocalRegistryAddress
+	setup := stepCommands(info, &commands.SetupServiceRegistryCommand)
+	got := recorder.Commands()
+
+	assert.Equal(t, setup, got[len(got)-len(setup):], "the registry is started before pushing to it")
+}
+
+func TestStreamApplicationImageWithoutZstd(t *testing.T) {
+	proj := newTestProject(t)
+	info := newTestContext(proj)
+
+	fakeDocker(t)
+	recorder := &sshtest.Recorder{
+		Handler: func(command string, stdin []byte) (string, int) {
+			if command == "command -v zstd" {
+				return "", 1
+			}
+
+			return "", 0
+		},
+	}
+
+	assert.NoError(t, streamApplicationImage(context.Background(), recorder, "zstd", info, false))
+	assert.Equal(t, []string{"command -v zstd", "gunzip -c | docker load"}, recorder.Commands(), "falls back to gzip")
+
+	_, err := gzip.NewReader(bytes.NewReader(recorder.Execs()[1].Stdin))
+	assert.NoError(t, err)
+}
+
+/*
+fakeDocker puts a docker on the PATH that only records its arguments,
+one line per run, in the returned file.
+*/
+func fakeDocker(t *testing.T) string {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "docker.log")
+	script := "#!/bin/sh\necho \"$*\" >> " + contextinfo.ShellQuote(log) + "\n"
+
+	if err := os.WriteFile(filepath.Join(dir, "docker"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return log
+}
+
+func indexOf(commands []string, command string) int {
+	for i, c := range commands {
+		if c == command {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func TestHealthCheckQuotesPath(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{
+			name: "shell characters are quoted",
+			path: "/health?next=$(reboot)",
+			want: "'/health?next=$(reboot)'",
+		},
+		{
+			name: "a missing leading slash is added",
+			path: "health",
+			want: "'/health'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proj := newTestProject(t)
+			proj.HealthCheck = project.HealthCheck{Path: tt.path}
+
+			got := stepCommands(newTestContext(proj), &commands.HealthCheckApplicationCommand)[0]
+
+			assert.Contains(t, got, `"http://$host:3000"`+tt.want)
+			assert.Contains(t, got, `from "`+tt.want+`", got`)
+		})
+	}
+}
+
+func newTestProject(t *testing.T) *project.PusherProject {
+	buildContext := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(buildContext, "Dockerfile"), []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return &project.PusherProject{
+		Build:       project.BuildRemote,
+		Docker:      project.DockerBuild{Context: buildContext},
+		Domain:      "myapp.example.com",
+		EnvFile:     ".env",
+		Host:        "server",
+		Port:        3000,
+		ServiceName: "myapp",
+		Version:     2,
+	}
+}
+
+func newTestContext(proj *project.PusherProject) contextinfo.ContextInfo {
+	info := contextinfo.ContextInfo{User: "pusher", ImageTag: "3"}
+	sshutils.ApplyProject(&info, proj)
+
+	return info
+}
+
+func tarNames(t *testing.T, b []byte) []string {
+	result := []string{}
+	gz, err := gzip.NewReader(bytes.NewReader(b))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := tar.NewReader(gz)
+
+	for {
+		header, err := reader.Next()
+
+		if err == io.EOF {
+			return result
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result = append(result, header.Name)
+	}
+}
@@ -0,0 +1,508 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adampresley/pusher/pkg/commands"
+	"github.com/adampresley/pusher/pkg/contextinfo"
+	"github.com/adampresley/pusher/pkg/envfile"
+	"github.com/adampresley/pusher/pkg/project"
+	"github.com/adampresley/pusher/pkg/rendering"
+	"github.com/adampresley/pusher/pkg/sshutils"
+	"github.com/adampresley/pusher/pkg/validation"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Manage your application's environment variables on the server",
+	Long: `List, change, pull, and push the env file your application
+uses on the server, without redeploying.`,
+}
+
+var envListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the environment variables on the server",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		debug, _ := cmd.Flags().GetBool("debug")
+		ctx := cmd.Context()
+		reveal, _ := cmd.Flags().GetBool("reveal")
+
+		proj, executor, contextInfo := loadEnvProject(cmd)
+		defer executor.Close()
+
+		remote, err := readRemoteEnvFile(ctx, executor, proj, contextInfo, debug)
+
+		if err != nil {
+			rendering.Error("%s", err.Error())
+			os.Exit(1)
+		}
+
+		rows := [][]string{{"Key", "Value"}}
+
+		for _, v := range remote.Variables() {
+			value := v.Value
+
+			if !reveal {
+				value = envfile.Mask(v.Key, value)
+			}
+
+			rows = append(rows, []string{v.Key, value})
+		}
+
+		if len(rows) == 1 {
+			rendering.Warning("There are no environment variables in '%s'.", remoteEnvFilePath(proj))
+			return
+		}
+
+		rendering.Table(rows)
+	},
+}
+
+var envGetCmd = &cobra.Command{
+	Use:   "get KEY",
+	Short: "Print the value of an environment variable on the server",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		debug, _ := cmd.Flags().GetBool("debug")
+		ctx := cmd.Context()
+
+		proj, executor, contextInfo := loadEnvProject(cmd)
+		defer executor.Close()
+
+		remote, err := readRemoteEnvFile(ctx, executor, proj, contextInfo, debug)
+
+		if err != nil {
+			rendering.Error("%s", err.Error())
+			os.Exit(1)
+		}
+
+		value, found := remote.Get(args[0])
+
+		if !found {
+			rendering.Error("'%s' is not set in '%s'.", args[0], remoteEnvFilePath(proj))
+			os.Exit(1)
+		}
+
+		fmt.Println(value)
+	},
+}
+
+var envSetCmd = &cobra.Command{
+	Use:   "set KEY=VALUE [KEY=VALUE...]",
+	Short: "Set environment variables on the server",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		debug, _ := cmd.Flags().GetBool("debug")
+		ctx := cmd.Context()
+
+		for _, arg := range args {
+			if key, _, found := strings.Cut(arg, "="); !found || strings.TrimSpace(key) == "" {
+				rendering.Error("'%s' is not in the format KEY=VALUE.", arg)
+				os.Exit(1)
+			}
+		}
+
+		proj, executor, contextInfo := loadEnvProject(cmd)
+		defer executor.Close()
+
+		remote, err := readRemoteEnvFile(ctx, executor, proj, contextInfo, debug)
+
+		if err != nil {
+			rendering.Error("%s", err.Error())
+			os.Exit(1)
+		}
+
+		for _, arg := range args {
+			key, value, _ := strings.Cut(arg, "=")
+			remote.Set(strings.TrimSpace(key), value)
+		}
+
+		writeRemoteEnvFile(ctx, executor, proj, contextInfo, remote, debug)
+		rendering.Success("Updated %d variable(s) in '%s'.", len(args), remoteEnvFilePath(proj))
+		restartAfterEnvChange(cmd, executor, proj, contextInfo, debug)
+	},
+}
+
+var envUnsetCmd = &cobra.Command{
+	Use:   "unset KEY [KEY...]",
+	Short: "Remove environment variables on the server",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		debug, _ := cmd.Flags().GetBool("debug")
+		ctx := cmd.Context()
+
+		proj, executor, contextInfo := loadEnvProject(cmd)
+		defer executor.Close()
+
+		remote, err := readRemoteEnvFile(ctx, executor, proj, contextInfo, debug)
+
+		if err != nil {
+			rendering.Error("%s", err.Error())
+			os.Exit(1)
+		}
+
+		removed := 0
+
+		for _, key := range args {
+			if remote.Unset(key) {
+				removed++
+			} else {
+				rendering.Warning("'%s' is not set.", key)
+			}
+		}
+
+		if removed == 0 {
+			return
+		}
+
+		writeRemoteEnvFile(ctx, executor, proj, contextInfo, remote, debug)
+		rendering.Success("Removed %d variable(s) from '%s'.", removed, remoteEnvFilePath(proj))
+		restartAfterEnvChange(cmd, executor, proj, contextInfo, debug)
+	},
+}
+
+var envPullCmd = &cobra.Command{
+	Use:   "pull",
+	Short: "Download the env file from the server",
+	Long: `Download the env file from the server and overwrite your
+local copy of it.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		debug, _ := cmd.Flags().GetBool("debug")
+		ctx := cmd.Context()
+
+		proj, executor, contextInfo := loadEnvProject(cmd)
+		defer executor.Close()
+
+		remote, err := readRemoteEnvFile(ctx, executor, proj, contextInfo, debug)
+
+		if err != nil {
+			rendering.Error("%s", err.Error())
+			os.Exit(1)
+		}
+
+		if _, err := os.Stat(proj.EnvFile); err == nil {
+			b, err := readLocalEnvFile(proj)
+
+			if err != nil {
+				rendering.Error("%s", err.Error())
+				os.Exit(1)
+			}
+
+			if string(b) == remote.String() {
+				rendering.Success("'%s' is already up to date.", proj.EnvFile)
+				return
+			}
+
+			if !isNonInteractive(cmd) {
+				confirmation, _ := pterm.DefaultInteractiveConfirm.Show(fmt.Sprintf("Overwrite your local '%s'?", proj.EnvFile))
+
+				if !confirmation {
+					rendering.Warning("User cancelled. Aborting.")
+					os.Exit(0)
+				}
+			}
+		}
+
+		if err := writeLocalEnvFile(proj, []byte(remote.String())); err != nil {
+			rendering.Error("There was a problem writing '%s': %s", proj.EnvFile, err.Error())
+			os.Exit(1)
+		}
+
+		rendering.Success("Saved %d variable(s) to '%s'.", len(remote.Variables()), proj.EnvFile)
+	},
+}
+
+var envPushCmd = &cobra.Command{
+	Use:   "push",
+	Short: "Upload your local env file to the server",
+	Long: `Compare your local env file with the one on the server, show
+what would change, and upload it once you confirm.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			err   error
+			b     []byte
+			local *envfile.EnvFile
+		)
+
+		debug, _ := cmd.Flags().GetBool("debug")
+		ctx := cmd.Context()
+		reveal, _ := cmd.Flags().GetBool("reveal")
+
+		proj, executor, contextInfo := loadEnvProject(cmd)
+		defer executor.Close()
+
+		if b, err = readLocalEnvFile(proj); err != nil {
+			rendering.Error("%s", err.Error())
+			os.Exit(1)
+		}
+
+		if err = validateEnvFile(proj, b); err != nil {
+			rendering.Error("%s", err.Error())
+			os.Exit(1)
+		}
+
+		if local, err = envfile.Parse(bytes.NewReader(b)); err != nil {
+			rendering.Error("There was a problem reading '%s': %s", proj.EnvFile, err.Error())
+			os.Exit(1)
+		}
+
+		remote, err := readRemoteEnvFile(ctx, executor, proj, contextInfo, debug)
+
+		if err != nil {
+			rendering.Error("%s", err.Error())
+			os.Exit(1)
+		}
+
+		changes := envfile.Diff(remote, local)
+
+		if len(changes) == 0 {
+			rendering.Success("The server is already up to date.")
+			return
+		}
+
+		printEnvChanges(changes, reveal)
+
+		if !isNonInteractive(cmd) {
+			confirmation, _ := pterm.DefaultInteractiveConfirm.Show("Push these changes to the server?")
+
+			if !confirmation {
+				rendering.Warning("User cancelled. Aborting.")
+				os.Exit(0)
+			}
+		}
+
+		writeRemoteEnvFile(ctx, executor, proj, contextInfo, local, debug)
+		rendering.Success("Pushed '%s' to the server.", proj.EnvFile)
+		restartAfterEnvChange(cmd, executor, proj, contextInfo, debug)
+	},
+}
+
+/*
+loadEnvProject loads the project and connects to its host, exiting on
+failure.
+*/
+func loadEnvProject(cmd *cobra.Command) (*project.PusherProject, *sshutils.GophExecutor, contextinfo.ContextInfo) {
+	proj, err := loadProject(cmd)
+
+	if err != nil {
+		rendering.Error("There was a problem loading your project configuration file: %s", err.Error())
+		os.Exit(1)
+	}
+
+	if proj.Host == "" || proj.ServiceName == "" {
+		rendering.Error("This project hasn't been deployed yet. Run 'pusher deploy' first.")
+		os.Exit(1)
+	}
+
+	if proj.EnvFile == "" {
+		proj.EnvFile = ".env"
+	}
+
+	sshClient, contextInfo := connectToProject(proj)
+	return proj, sshutils.NewGophExecutor(sshClient), contextInfo
+}
+
+/*
+remoteEnvFilePath is where deploy puts the env file, relative to the
+user's home directory on the server.
+*/
+func remoteEnvFilePath(proj *project.PusherProject) string {
+	return "applications/" + proj.ServiceName + "/" + proj.RemoteEnvFileName()
+}
+
+/*
+readRemoteEnvFile reads the env file from the server. A file that
+doesn't exist yet is empty, but any other problem reading it is an
+error, so a failed read is never written back over the real file.
+*/
+func readRemoteEnvFile(ctx context.Context, executor sshutils.Executor, proj *project.PusherProject, info contextinfo.ContextInfo, debug bool) (*envfile.EnvFile, error) {
+	path := info.Quote(remoteEnvFilePath(proj))
+	command := "[ ! -e " + path + " ] || cat " + path
+
+	if debug {
+		rendering.Print("COMMAND: %s", command)
+	}
+
+	b, err := executor.Run(ctx, command)
+
+	if err != nil {
+		return nil, fmt.Errorf("There was a problem reading '%s' from the server: %s %s", remoteEnvFilePath(proj), err.Error(), strings.TrimSpace(string(b)))
+	}
+
+	result, err := envfile.ParseString(string(b))
+
+	if err != nil {
+		return nil, fmt.Errorf("There was a problem reading '%s' from the server: %s", remoteEnvFilePath(proj), err.Error())
+	}
+
+	return result, nil
+}
+
+/*
+writeRemoteEnvFile replaces the env file on the server. The contents are
+sent over the SSH session, so nothing is written to a local temp file.
+*/
+func writeRemoteEnvFile(ctx context.Context, executor sshutils.Executor, proj *project.PusherProject, info contextinfo.ContextInfo, file *envfile.EnvFile, debug bool) {
+	path := info.Quote(remoteEnvFilePath(proj))
+	command := "mkdir -p " + info.Quote(filepath.Dir(remoteEnvFilePath(proj))) + " && umask 077 && cat > " + path
+
+	if output, err := sshutils.Stream(ctx, executor, info, command, strings.NewReader(file.String()), debug); err != nil {
+		rendering.Error("There was a problem writing '%s' on the server: %s %s", remoteEnvFilePath(proj), err.Error(), string(output))
+		os.Exit(1)
+	}
+}
+
+/*
+restartAfterEnvChange recreates the running container with
+'docker compose up -d' when --restart was given, so it picks up the
+new environment.
+*/
+func restartAfterEnvChange(cmd *cobra.Command, executor sshutils.Executor, proj *project.PusherProject, info contextinfo.ContextInfo, debug bool) {
+	restart, _ := cmd.Flags().GetBool("restart")
+	ctx := cmd.Context()
+
+	if !restart {
+		rendering.Print("Restart your application, or run again with --restart, for the changes to take effect.")
+		return
+	}
+
+	if err := resolveActiveColor(ctx, executor, proj, &info); err != nil {
+		rendering.Error("%s", err.Error())
+		os.Exit(1)
+	}
+
+	if err := commands.StartApplicationCommand.Run(ctx, executor, info, debug); err != nil {
+		os.Exit(1)
+	}
+}
+
+/*
+validateEnvFile checks env file contents against the env schema in
+pusher.yaml and the example file, printing a report of every problem.
+*/
+func validateEnvFile(proj *project.PusherProject, contents []byte) error {
+	var (
+		err     error
+		file    *envfile.EnvFile
+		example *envfile.EnvFile
+		report  validation.EnvFileReport
+		b       []byte
+	)
+
+	if file, err = envfile.Parse(bytes.NewReader(contents)); err != nil {
+		return fmt.Errorf("There was a problem reading '%s': %s", proj.EnvFile, err.Error())
+	}
+
+	exampleFileName := proj.EnvSchema.GetExample()
+
+	if b, err = os.ReadFile(exampleFileName); err == nil {
+		if example, err = envfile.Parse(bytes.NewReader(b)); err != nil {
+			return fmt.Errorf("There was a problem reading '%s': %s", exampleFileName, err.Error())
+		}
+	}
+
+	if report, err = validation.ValidateEnvFile(file, proj.EnvSchema, example); err != nil {
+		return err
+	}
+
+	if report.IsValid() {
+		return nil
+	}
+
+	sections := []struct {
+		title string
+		keys  []string
+	}{
+		{"Missing", report.Missing},
+		{"Not in " + exampleFileName, report.Extra},
+		{"Empty", report.Empty},
+		{"Duplicated", report.Duplicate},
+		{"Invalid", report.Invalid},
+	}
+
+	rendering.Error("The env file '%s' has problems:", proj.EnvFile)
+
+	for _, section := range sections {
+		if len(section.keys) > 0 {
+			rendering.Print("  %s: %s", section.title, strings.Join(section.keys, ", "))
+		}
+	}
+
+	rendering.BlankLine()
+	return fmt.Errorf("Fix '%s', or the env schema in %s, and try again", proj.EnvFile, project.PusherProjectFileName)
+}
+
+func printEnvChanges(changes []envfile.Change, reveal bool) {
+	mask := func(key, value string) string {
+		if reveal {
+			return value
+		}
+
+		return envfile.Mask(key, value)
+	}
+
+	for _, change := range changes {
+		switch change.Kind {
+		case envfile.ChangeAdded:
+			pterm.FgGreen.Printfln("+ %s=%s", change.Key, mask(change.Key, change.NewValue))
+
+		case envfile.ChangeRemoved:
+			pterm.FgRed.Printfln("- %s=%s", change.Key, mask(change.Key, change.OldValue))
+
+		case envfile.ChangeUpdated:
+			pterm.FgYellow.Printfln("~ %s: %s -> %s", change.Key, mask(change.Key, change.OldValue), mask(change.Key, change.NewValue))
+		}
+	}
+
+	rendering.BlankLine()
+}
+
+func init() {
+	for _, c := range []*cobra.Command{envListCmd, envGetCmd, envSetCmd, envUnsetCmd, envPullCmd, envPushCmd} {
+		c.Flags().BoolP("debug", "d", false, "Enable debug output")
+		envCmd.AddCommand(c)
+	}
+
+	envListCmd.Flags().Bool("reveal", false, "Show secret values instead of masking them")
+	envPushCmd.Flags().Bool("reveal", false, "Show secret values in the diff instead of masking them")
+
+	for _, c := range []*cobra.Command{envSetCmd, envUnsetCmd, envPushCmd} {
+		c.Flags().Bool("restart", false, "Restart the application with 'docker compose up -d' afterwards")
+	}
+
+	addNonInteractiveFlags(envPullCmd)
+	addNonInteractiveFlags(envPushCmd)
+
+	rootCmd.AddCommand(envCmd)
+}
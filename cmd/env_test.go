@@ -0,0 +1,69 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/adampresley/pusher/pkg/sshtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadRemoteEnvFile(t *testing.T) {
+	proj := newTestProject(t)
+	info := newTestContext(proj)
+
+	tests := []struct {
+		name    string
+		output  string
+		status  int
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "existing file", output: "A=1\nB='two words'\n", want: map[string]string{"A": "1", "B": "two words"}},
+		{name: "missing file is empty", want: map[string]string{}},
+		{name: "unreadable file is an error", output: "cat: applications/myapp/.env: Permission denied", status: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &sshtest.Recorder{
+				Handler: func(command string, stdin []byte) (string, int) {
+					return tt.output, tt.status
+				},
+			}
+
+			got, err := readRemoteEnvFile(context.Background(), recorder, proj, info, false)
+
+			assert.Equal(t, []string{"[ ! -e 'applications/myapp/.env' ] || cat 'applications/myapp/.env'"}, recorder.Commands())
+
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "Permission denied")
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got.Map())
+		})
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/adampresley/pusher/pkg/contextinfo"
+	"github.com/adampresley/pusher/pkg/rendering"
+	"github.com/adampresley/pusher/pkg/sshutils"
+	"github.com/melbahja/goph"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	/*
+	 * defaultShell starts bash when the image has it, and sh otherwise.
+	 */
+	defaultShell string = `sh -c 'command -v bash >/dev/null 2>&1 && exec bash || exec sh'`
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec -- COMMAND [ARGS...]",
+	Short: "Run a command inside your application's container",
+	Long: `Run a one-off command, such as a migration or management script,
+inside your application's container and print its output. Put the
+command after -- so its flags aren't read as pusher's.`,
+	Example: `  pusher exec -- ./manage.py migrate
+  pusher exec --service postgres -- psql -U root -c 'select 1'`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		debug, _ := cmd.Flags().GetBool("debug")
+		service, _ := cmd.Flags().GetString("service")
+
+		sshClient, contextInfo, container := connectToContainer(cmd, service)
+		defer sshClient.Close()
+
+		command := "sudo docker exec " + contextInfo.Quote(container) + " " + quoteArgs(contextInfo, args)
+		exitWithRemoteStatus(sshutils.Follow(cmd.Context(), sshClient, contextInfo, command, debug))
+	},
+}
+
+var shellCmd = &cobra.Command{
+	Use:   "shell [-- COMMAND [ARGS...]]",
+	Short: "Open an interactive shell inside your application's container",
+	Long: `Open an interactive shell, or another interactive program such as
+a REPL, inside your application's container.`,
+	Example: `  pusher shell
+  pusher shell -- node
+  pusher shell --service postgres -- psql -U root`,
+	Run: func(cmd *cobra.Command, args []string) {
+		debug, _ := cmd.Flags().GetBool("debug")
+		service, _ := cmd.Flags().GetString("service")
+
+		sshClient, contextInfo, container := connectToContainer(cmd, service)
+		defer sshClient.Close()
+
+		program := defaultShell
+
+		if len(args) > 0 {
+			program = quoteArgs(contextInfo, args)
+		}
+
+		command := "sudo docker exec -it " + contextInfo.Quote(container) + " " + program
+		exitWithRemoteStatus(sshutils.Interactive(cmd.Context(), sshClient, contextInfo, command, debug))
+	},
+}
+
+func connectToContainer(cmd *cobra.Command, service string) (*goph.Client, contextinfo.ContextInfo, string) {
+	proj := loadAppProject(cmd)
+	sshClient, contextInfo := connectToProject(proj)
+
+	container, err := resolveContainer(cmd.Context(), sshutils.NewGophExecutor(sshClient), proj, &contextInfo, service)
+
+	if err != nil {
+		sshClient.Close()
+		rendering.Error("%s", err.Error())
+		os.Exit(1)
+	}
+
+	return sshClient, contextInfo, container
+}
+
+func quoteArgs(info contextinfo.ContextInfo, args []string) string {
+	quoted := []string{}
+
+	for _, arg := range args {
+		quoted = append(quoted, info.Quote(arg))
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+/*
+exitWithRemoteStatus exits with the remote command's exit code, so
+scripts calling pusher can tell when it failed.
+*/
+func exitWithRemoteStatus(err error) {
+	var exitError *ssh.ExitError
+
+	if err == nil {
+		return
+	}
+
+	if errors.As(err, &exitError) {
+		os.Exit(exitError.ExitStatus())
+	}
+
+	rendering.Error("%s", err.Error())
+	os.Exit(1)
+}
+
+func init() {
+	for _, c := range []*cobra.Command{execCmd, shellCmd} {
+		c.Flags().BoolP("debug", "d", false, "Enable debug output")
+		c.Flags().String("service", "", "Use a service container instead, such as postgres")
+		rootCmd.AddCommand(c)
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"os"
+	"strings"
+
+	"github.com/adampresley/pusher/pkg/rendering"
+	"github.com/adampresley/pusher/pkg/sshutils"
+	"github.com/spf13/cobra"
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Show your application's logs",
+	Long: `Show the logs of your application's container, or of a service
+installed with 'pusher service'. Use --follow to keep streaming new
+lines until you press Ctrl-C.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			err error
+		)
+
+		debug, _ := cmd.Flags().GetBool("debug")
+		ctx := cmd.Context()
+		follow, _ := cmd.Flags().GetBool("follow")
+		since, _ := cmd.Flags().GetString("since")
+		tail, _ := cmd.Flags().GetString("tail")
+		service, _ := cmd.Flags().GetString("service")
+		accessLog, _ := cmd.Flags().GetBool("access-log")
+
+		proj, err := loadProject(cmd)
+
+		if err != nil {
+			rendering.Error("There was a problem loading your project configuration file: %s", err.Error())
+			os.Exit(1)
+		}
+
+		if service != "" && accessLog {
+			rendering.Error("--access-log shows requests to your application, and can't be used with --service.")
+			os.Exit(1)
+		}
+
+		sshClient, contextInfo := connectToProject(proj)
+		defer sshClient.Close()
+
+		container, err := resolveContainer(ctx, sshutils.NewGophExecutor(sshClient), proj, &contextInfo, service)
+
+		if err != nil {
+			rendering.Error("%s", err.Error())
+			os.Exit(1)
+		}
+
+		options := []string{"--tail", contextInfo.Quote(tail)}
+
+		if since != "" {
+			options = append(options, "--since", contextInfo.Quote(since))
+		}
+
+		if follow {
+			options = append(options, "--follow")
+		}
+
+		command := "sudo docker logs " + strings.Join(options, " ") + " " + contextInfo.Quote(container) + " 2>&1"
+
+		/*
+		 * Traefik writes its access log as JSON to its own container
+		 * log. Only keep the lines for this application's routers.
+		 */
+		if accessLog {
+			router := `"RouterName":"` + proj.ServiceName + `(-blue|-green)?@`
+
+			command = command + " & sudo docker logs " + strings.Join(options, " ") + " traefik 2>&1" +
+				" | grep --line-buffered -E " + contextInfo.Quote(router) +
+				" | sed -u 's/^/[traefik] /' & wait"
+		}
+
+		if err = sshutils.Follow(cmd.Context(), sshClient, contextInfo, command, debug); err != nil {
+			rendering.Error("There was a problem reading the logs of '%s': %s", container, err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	logsCmd.Flags().BoolP("debug", "d", false, "Enable debug output")
+	logsCmd.Flags().BoolP("follow", "f", false, "Keep streaming new log lines until Ctrl-C")
+	logsCmd.Flags().String("since", "", "Only show logs since a timestamp (2024-01-02T13:23:37Z) or relative time (10m)")
+	logsCmd.Flags().String("tail", "100", "Number of lines to show from the end of the logs, or 'all'")
+	logsCmd.Flags().String("service", "", "Show the logs of a service container instead, such as postgres")
+	logsCmd.Flags().Bool("access-log", false, "Include Traefik access logs for your application")
+	rootCmd.AddCommand(logsCmd)
+}
@@ -0,0 +1,68 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/adampresley/pusher/pkg/contextinfo"
+	"github.com/adampresley/pusher/pkg/sshutils"
+	"github.com/pterm/pterm"
+)
+
+func TestMain(m *testing.M) {
+	pterm.DisableOutput()
+	os.Exit(m.Run())
+}
+
+/*
+stepCommands returns the commands steps send to the server, in order.
+*/
+func stepCommands(info contextinfo.ContextInfo, steps ...*sshutils.Step) []string {
+	result := []string{}
+
+	for _, step := range steps {
+		for _, command := range step.Commands {
+			result = append(result, info.ExpandCommand(command.Command))
+		}
+	}
+
+	return result
+}
+
+/*
+withoutRetryDelays retries the commands in steps straight away until the
+test ends, so tests of failures don't wait out the backoff.
+*/
+func withoutRetryDelays(t *testing.T, steps ...*sshutils.Step) {
+	for _, step := range steps {
+		original := step.Commands
+		step.Commands = append([]sshutils.Command{}, original...)
+
+		for i := range step.Commands {
+			step.Commands[i].Retry.Delay = 0
+		}
+
+		t.Cleanup(func() { step.Commands = original })
+	}
+}
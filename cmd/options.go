@@ -0,0 +1,148 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/adampresley/pusher/pkg/project"
+	"github.com/adampresley/pusher/pkg/rendering"
+	"github.com/spf13/cobra"
+)
+
+/*
+addNonInteractiveFlags adds the flags used to run a command without
+any prompts, such as in a CI pipeline.
+*/
+func addNonInteractiveFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolP("yes", "y", false, "Run without prompting. Values come from flags, environment variables, or "+project.PusherProjectFileName)
+	cmd.Flags().Bool("non-interactive", false, "Alias for --yes")
+}
+
+/*
+isNonInteractive returns true when the user asked us not to prompt, either
+with --yes, --non-interactive, or the PUSHER_NON_INTERACTIVE environment variable.
+*/
+func isNonInteractive(cmd *cobra.Command) bool {
+	yes, _ := cmd.Flags().GetBool("yes")
+	nonInteractive, _ := cmd.Flags().GetBool("non-interactive")
+
+	if yes || nonInteractive {
+		return true
+	}
+
+	result, _ := strconv.ParseBool(os.Getenv("PUSHER_NON_INTERACTIVE"))
+	return result
+}
+
+/*
+optionEnvName returns the environment variable equivalent of a flag.
+For example, "service-name" becomes PUSHER_SERVICE_NAME.
+*/
+func optionEnvName(flagName string) string {
+	return "PUSHER_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+/*
+stringOption returns the value of a flag, falling back to its environment
+variable. The second return value is false when neither was set.
+*/
+func stringOption(cmd *cobra.Command, flagName string) (string, bool) {
+	if cmd.Flags().Changed(flagName) {
+		value, _ := cmd.Flags().GetString(flagName)
+		return value, true
+	}
+
+	return os.LookupEnv(optionEnvName(flagName))
+}
+
+/*
+stringSliceOption returns the values of a repeatable flag, falling back to
+a comma separated environment variable.
+*/
+func stringSliceOption(cmd *cobra.Command, flagName string) ([]string, bool) {
+	if cmd.Flags().Changed(flagName) {
+		value, _ := cmd.Flags().GetStringArray(flagName)
+		return value, true
+	}
+
+	value, ok := os.LookupEnv(optionEnvName(flagName))
+
+	if !ok {
+		return nil, false
+	}
+
+	result := []string{}
+
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+
+	return result, true
+}
+
+/*
+missingOptionError describes a required value that was not provided in
+non-interactive mode, and every place it could have come from.
+*/
+func missingOptionError(flagName, yamlKey string) error {
+	return fmt.Errorf(
+		"A value for '%s' is required. Provide it with --%s, the %s environment variable, or '%s' in %s",
+		flagName,
+		flagName,
+		optionEnvName(flagName),
+		yamlKey,
+		project.PusherProjectFileName,
+	)
+}
+
+/*
+environmentName returns the environment selected with --env or PUSHER_ENV.
+*/
+func environmentName(cmd *cobra.Command) string {
+	value, _ := stringOption(cmd, "env")
+	return value
+}
+
+/*
+loadProject loads the project file and selects the environment, if any,
+chosen with --env.
+*/
+func loadProject(cmd *cobra.Command) (*project.PusherProject, error) {
+	result := &project.PusherProject{}
+	name := environmentName(cmd)
+
+	if err := result.LoadEnvironment(name); err != nil {
+		return result, err
+	}
+
+	if name != "" {
+		rendering.Print("Using environment '%s'.", name)
+	}
+
+	return result, nil
+}
@@ -22,6 +22,7 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
 	"io/fs"
 	"os"
 
@@ -35,6 +36,7 @@ import (
 	"github.com/melbahja/goph"
 	"github.com/pterm/pterm"
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
 )
 
 var prepareCmd = &cobra.Command{
@@ -48,12 +50,18 @@ will install the necessary software, such as Traefik and Docker.`,
 			f              fs.File
 			availableHosts []string
 			host           string
+			hostProvided   bool
 			certEmail      string
+			emailProvided  bool
 			contextInfo    contextinfo.ContextInfo
 			sshClient      *goph.Client
 		)
 
 		debug, _ := cmd.Flags().GetBool("debug")
+		summary := sshutils.NewRunSummary()
+		ctx := sshutils.WithRunSummary(cmd.Context(), summary)
+		nonInteractive := isNonInteractive(cmd)
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
 
 		if debug {
 			rendering.Print("Debug enabled.")
@@ -62,85 +70,146 @@ will install the necessary software, such as Traefik and Docker.`,
 		rendering.Banner()
 		rendering.Print("Let's setup your server. To get started, let's get some information.")
 		rendering.Paragraph(`Pusher requires you to have an SSH config file with hosts
-         configured. Each host entry must have a name, a HostName, a User, and an IdentityFile.`)
+         configured. Each host entry must have a name, a HostName, and a User. Keys are taken
+         from ssh-agent, then from the host's IdentityFile.`)
 		rendering.BlankLine()
 
+		proj := &project.PusherProject{}
+		envName := environmentName(cmd)
+		host, hostProvided = stringOption(cmd, "host")
+		certEmail, emailProvided = stringOption(cmd, "email")
+
 		/*
-		 * If the project already exists, prompt the user about overwriting.
+		 * Keep any existing project settings and deploy history when running
+		 * non-interactively, or when preparing a single environment.
 		 */
-		if project.ProjectFileExists() {
-			rendering.Warning(
-				`A project file (%s) already exists. 
+		if (nonInteractive || envName != "") && project.ProjectFileExists() {
+			if err = proj.Load(); err != nil {
+				rendering.Error("There was a problem loading your project configuration file: %s", err.Error())
+				os.Exit(1)
+			}
+		}
+
+		if err = proj.SelectEnvironment(envName, true); err != nil {
+			rendering.Error("%s", err.Error())
+			os.Exit(1)
+		}
+
+		if nonInteractive {
+			/*
+			 * Host and email come from flags, the environment, or the project file.
+			 */
+			if !hostProvided {
+				host = proj.Host
+			}
+
+			if !emailProvided {
+				certEmail = proj.CertEmail
+			}
+
+			if host == "" {
+				rendering.Error("%s", missingOptionError("host", "host").Error())
+				os.Exit(1)
+			}
+
+			if certEmail == "" {
+				rendering.Error("%s", missingOptionError("email", "certemail").Error())
+				os.Exit(1)
+			}
+
+			if !validation.IsValidEmail(certEmail) {
+				rendering.Error("'%s' is not a valid email address. One is required for setting up Traefik and LetsEncrypt.", certEmail)
+				os.Exit(1)
+			}
+		} else {
+			/*
+			 * If the project already exists, prompt the user about overwriting.
+			 */
+			if envName == "" && project.ProjectFileExists() {
+				rendering.Warning(
+					`A project file (%s) already exists. 
 If you overwrite it, any settings
 and previous deploys will be lost.`,
-				project.PusherProjectFileName,
-			)
+					project.PusherProjectFileName,
+				)
 
-			overwrite, _ := pterm.DefaultInteractiveConfirm.
-				WithDefaultText("Overwrite project file?").
-				Show()
+				overwrite, _ := pterm.DefaultInteractiveConfirm.
+					WithDefaultText("Overwrite project file?").
+					Show()
 
-			if !overwrite {
-				rendering.Error("Aborting.")
-				os.Exit(0)
+				if !overwrite {
+					rendering.Error("Aborting.")
+					os.Exit(0)
+				}
 			}
-		}
 
-		/*
-		 * Get available hosts, then prompt the user to choose one.
-		 */
-		if f, err = parsing.OpenSSHConfigFile(parsing.DefaultSSHConfigFile); err != nil {
-			rendering.Error(
-				"There was a problem opening the SSH config file:\n  file: %s\n  error: %s\n",
-				parsing.DefaultSSHConfigFile,
-				err.Error(),
-			)
-			os.Exit(1)
-		}
+			/*
+			 * Get available hosts, then prompt the user to choose one.
+			 */
+			if !hostProvided {
+				if f, err = parsing.OpenSSHConfigFile(parsing.DefaultSSHConfigFile); err != nil {
+					rendering.Error(
+						"There was a problem opening the SSH config file:\n  file: %s\n  error: %s\n",
+						parsing.DefaultSSHConfigFile,
+						err.Error(),
+					)
+					os.Exit(1)
+				}
 
-		defer f.Close()
+				defer f.Close()
 
-		if availableHosts, err = parsing.GetSSHConfigHosts(f); err != nil {
-			rendering.Error(
-				"Unable to parse your SSH config file:\n  file: %s\n  error: %s\n",
-				parsing.DefaultSSHConfigFile,
-				err.Error(),
-			)
-			os.Exit(1)
-		}
+				if availableHosts, err = parsing.GetSSHConfigHosts(f); err != nil {
+					rendering.Error(
+						"Unable to parse your SSH config file:\n  file: %s\n  error: %s\n",
+						parsing.DefaultSSHConfigFile,
+						err.Error(),
+					)
+					os.Exit(1)
+				}
 
-		host, _ = pterm.DefaultInteractiveSelect.
-			WithOptions(availableHosts).
-			WithDefaultText("Select a host").
-			Show()
+				host, _ = pterm.DefaultInteractiveSelect.
+					WithOptions(availableHosts).
+					WithDefaultText("Select a host").
+					Show()
+			}
 
 			/*
 			 * Get an email to user for certificate generation
 			 */
-	enteremail:
-		certEmailInput := pterm.DefaultInteractiveTextInput
-		certEmailInput.DefaultText = "Enter an email for LetsEncrypt SSL certs"
-		certEmail, _ = certEmailInput.Show()
-
-		if !validation.IsValidEmail(certEmail) {
-			rendering.Error("A valid email address is required for setting up Traefik and LetsEncrypt.")
-			goto enteremail
+			for !validation.IsValidEmail(certEmail) {
+				if emailProvided {
+					rendering.Error("A valid email address is required for setting up Traefik and LetsEncrypt.")
+				}
+
+				certEmailInput := pterm.DefaultInteractiveTextInput
+				certEmailInput.DefaultText = "Enter an email for LetsEncrypt SSL certs"
+				certEmail, _ = certEmailInput.Show()
+				emailProvided = true
+			}
 		}
 
 		/*
 		 * Save a project file with our settings
 		 */
-		proj := project.PusherProject{
-			CertEmail: certEmail,
-			Host:      host,
-		}
+		if env := proj.CurrentEnvironment(); env != nil {
+			env.Host = host
 
-		if err = proj.Save(); err != nil {
-			rendering.Error("%s - Aborting.", err.Error())
-			os.Exit(1)
+			if certEmail != proj.CertEmail {
+				env.CertEmail = certEmail
+			}
 		}
 
-		rendering.Success("Project file '%s' created.", project.PusherProjectFileName)
+		proj.CertEmail = certEmail
+		proj.Host = host
+
+		if !dryRun {
+			if err = proj.Save(); err != nil {
+				rendering.Error("%s - Aborting.", err.Error())
+				os.Exit(1)
+			}
+
+			rendering.Success("Project file '%s' saved.", project.PusherProjectFileName)
+		}
 
 		/*
 		 * Start setting up the server
@@ -148,41 +217,97 @@ and previous deploys will be lost.`,
 		rendering.BlankLine()
 		rendering.Header("Let's go! 🚀")
 
-		spinner := rendering.Spinner("Connecting to remote host...")
+		if dryRun {
+			if contextInfo, err = sshutils.GetHostInfo(host); err != nil {
+				rendering.Error("%s - Aborting.", err.Error())
+				os.Exit(1)
+			}
+
+			contextInfo.DryRun = true
+			rendering.Warning("Dry run. Nothing will be run on '%s'.", host)
+			rendering.BlankLine()
+		} else {
+			var prompt sshutils.HostKeyPrompt
 
-		if sshClient, contextInfo, err = sshutils.GetClient(host); err != nil {
-			rendering.Error("%s - Aborting.", err.Error())
-			os.Exit(1)
+			if !isNonInteractive(cmd) {
+				prompt = confirmHostKey
+			}
+
+			spinner := rendering.Spinner("Connecting to remote host...")
+
+			if sshClient, contextInfo, err = sshutils.GetClientWithPrompt(host, prompt); err != nil {
+				rendering.Error("%s - Aborting.", err.Error())
+				os.Exit(1)
+			}
+
+			defer sshClient.Close()
+			spinner.Success("Logged in successfully.")
 		}
 
 		contextInfo.Email = certEmail
-		defer sshClient.Close()
-		spinner.Success("Logged in successfully.")
 
 		/*
 		 * Start running through setup steps
 		 */
-		if err = commands.SetupBaseServerCommand.Run(sshClient, contextInfo, debug); err != nil {
+		if err = prepareServer(ctx, sshutils.NewGophExecutor(sshClient), contextInfo, debug); err != nil {
+			summary.Print()
 			os.Exit(1)
 		}
 
-		if err = commands.SetupDockerCommand.Run(sshClient, contextInfo, debug); err != nil {
-			os.Exit(1)
-		}
-
-		if err = commands.SetupTraefikCommand.Run(sshClient, contextInfo, debug); err != nil {
-			os.Exit(1)
-		}
+		summary.Print()
 
 		/*
 		 * Done!
 		 */
 		rendering.BlankLine()
+		if dryRun {
+			rendering.Success("Dry run complete.")
+			return
+		}
+
 		rendering.Header("🥂 Your server is now setup!")
 	},
 }
 
+/*
+prepareServer installs what the server needs to run applications: base
+packages, Docker, and Traefik.
+*/
+func prepareServer(ctx context.Context, executor sshutils.Executor, info contextinfo.ContextInfo, debug bool) error {
+	var (
+		err error
+	)
+
+	if err = commands.SetupBaseServerCommand.Run(ctx, executor, info, debug); err != nil {
+		return err
+	}
+
+	if err = commands.SetupDockerCommand.Run(ctx, executor, info, debug); err != nil {
+		return err
+	}
+
+	return commands.SetupTraefikCommand.Run(ctx, executor, info, debug)
+}
+
+/*
+confirmHostKey shows the fingerprint of a server we haven't connected to
+before and asks whether to trust it.
+*/
+func confirmHostKey(host string, key ssh.PublicKey) (bool, error) {
+	rendering.PauseSpinner()
+	rendering.BlankLine()
+	rendering.Warning("The authenticity of host '%s' can't be established.", host)
+	rendering.Print("%s key fingerprint is %s.", key.Type(), ssh.FingerprintSHA256(key))
+	rendering.Print("Compare it with the output of 'ssh-keygen -lf /etc/ssh/ssh_host_*_key.pub' on the server.")
+
+	return pterm.DefaultInteractiveConfirm.Show("Are you sure you want to continue connecting?")
+}
+
 func init() {
 	prepareCmd.Flags().BoolP("debug", "d", false, "Enable debug output")
+	prepareCmd.Flags().Bool("dry-run", false, "Print every command and generated file without connecting to the server")
+	addNonInteractiveFlags(prepareCmd)
+	prepareCmd.Flags().String("host", "", "SSH config host to prepare")
+	prepareCmd.Flags().String("email", "", "Email for LetsEncrypt SSL certs")
 	rootCmd.AddCommand(prepareCmd)
 }
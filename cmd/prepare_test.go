@@ -0,0 +1,99 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/adampresley/pusher/pkg/commands"
+	"github.com/adampresley/pusher/pkg/contextinfo"
+	"github.com/adampresley/pusher/pkg/sshtest"
+	"github.com/adampresley/pusher/pkg/sshutils"
+	"github.com/stretchr/testify/assert"
+)
+
+const aptUpdate = "sudo apt -o DPkg::Lock::Timeout=600 update -y"
+
+func TestPrepareServer(t *testing.T) {
+	server := sshtest.NewServer(t)
+	info := contextinfo.ContextInfo{User: "pusher", Email: "me@example.com"}
+
+	err := prepareServer(context.Background(), sshutils.NewGophExecutor(server.Dial(t)), info, false)
+	assert.NoError(t, err)
+
+	got := server.Commands()
+
+	assert.Equal(t, stepCommands(info, &commands.SetupBaseServerCommand, &commands.SetupDockerCommand, &commands.SetupTraefikCommand), got)
+	assert.Equal(t, []string{aptUpdate, "sudo apt -o DPkg::Lock::Timeout=600 upgrade -y"}, got[:2])
+	assert.Contains(t, got, "sudo usermod -aG docker pusher")
+	assert.Contains(t, strings.Join(got, "\n"), "email: me@example.com")
+}
+
+func TestPrepareServerStopsAtFirstFailure(t *testing.T) {
+	const dockerInstall = "sudo apt -o DPkg::Lock::Timeout=600 install docker-ce docker-ce-cli containerd.io docker-buildx-plugin docker-compose-plugin -y"
+
+	withoutRetryDelays(t, &commands.SetupDockerCommand)
+
+	server := sshtest.NewServer(t)
+	server.Handler = func(command string, stdin []byte) (string, int) {
+		if command == dockerInstall {
+			return "E: Unable to locate package docker-ce", 100
+		}
+
+		return "", 0
+	}
+
+	err := prepareServer(context.Background(), sshutils.NewGophExecutor(server.Dial(t)), contextinfo.ContextInfo{User: "pusher"}, false)
+	assert.Error(t, err)
+
+	got := server.Commands()
+	assert.Equal(t, []string{dockerInstall, dockerInstall, dockerInstall}, got[len(got)-3:], "the install is retried")
+	assert.NotContains(t, got, "sudo usermod -aG docker pusher", "nothing runs after the failed command")
+}
+
+func TestPrepareServerRetriesAptUpdate(t *testing.T) {
+	withoutRetryDelays(t, &commands.SetupBaseServerCommand)
+
+	failures := 1
+	server := sshtest.NewServer(t)
+	server.Handler = func(command string, stdin []byte) (string, int) {
+		if command == aptUpdate && failures > 0 {
+			failures--
+			return "Temporary failure resolving 'archive.ubuntu.com'", 100
+		}
+
+		return "", 0
+	}
+
+	summary := sshutils.NewRunSummary()
+	ctx := sshutils.WithRunSummary(context.Background(), summary)
+
+	assert.NoError(t, prepareServer(ctx, sshutils.NewGophExecutor(server.Dial(t)), contextinfo.ContextInfo{User: "pusher"}, false))
+	assert.Equal(t, []string{aptUpdate, aptUpdate, "sudo apt -o DPkg::Lock::Timeout=600 upgrade -y"}, server.Commands()[:3])
+
+	results := summary.Results()
+	assert.Equal(t, sshutils.CommandRetried, results[0].Status)
+	assert.Equal(t, 2, results[0].Attempts)
+	assert.Equal(t, sshutils.CommandRan, results[1].Status)
+}
@@ -0,0 +1,175 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/adampresley/pusher/pkg/commands"
+	"github.com/adampresley/pusher/pkg/contextinfo"
+	"github.com/adampresley/pusher/pkg/project"
+	"github.com/adampresley/pusher/pkg/rendering"
+	"github.com/adampresley/pusher/pkg/sshutils"
+	"github.com/melbahja/goph"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback [version]",
+	Short: "Roll back to a previously deployed version",
+	Long: `Point your application back at a previously deployed image
+and restart it. When no version is given you will be asked to
+choose one from the project's deploy history.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			err         error
+			version     int
+			deployment  project.Deployment
+			found       bool
+			sshClient   *goph.Client
+			contextInfo contextinfo.ContextInfo
+		)
+
+		debug, _ := cmd.Flags().GetBool("debug")
+		ctx := cmd.Context()
+
+		if debug {
+			rendering.Print("Debug enabled.")
+		}
+
+		rendering.Header("Roll Back a Deploy")
+
+		/*
+		 * First load the project
+		 */
+		proj, err := loadProject(cmd)
+
+		if err != nil {
+			rendering.Error("There was a problem loading your project configuration file: %s", err.Error())
+			os.Exit(1)
+		}
+
+		if len(proj.History) == 0 {
+			rendering.Error("There are no previous deploys recorded in '%s'.", project.PusherProjectFileName)
+			os.Exit(1)
+		}
+
+		/*
+		 * Figure out which version to roll back to. Either it was passed
+		 * in, or we ask the user to pick from the history.
+		 */
+		if len(args) > 0 {
+			if version, err = strconv.Atoi(args[0]); err != nil {
+				rendering.Error("Version must be a valid integer.")
+				os.Exit(1)
+			}
+
+			if deployment, found = proj.History.Find(version); !found {
+				rendering.Error("Version %d is not in the deploy history. Available versions: %v", version, proj.History.ToStrings())
+				os.Exit(1)
+			}
+
+			if version == proj.ActiveVersion {
+				rendering.Error("Already running version %d.", version)
+				os.Exit(1)
+			}
+		} else {
+			options := project.Deployments{}
+
+			for _, d := range proj.History {
+				if d.Version != proj.ActiveVersion {
+					options = append(options, d)
+				}
+			}
+
+			if len(options) == 0 {
+				rendering.Error("There are no other versions to roll back to.")
+				os.Exit(1)
+			}
+
+			selected, _ := pterm.DefaultInteractiveSelect.
+				WithOptions(options.ToStrings()).
+				WithDefaultText("Select a version").
+				Show()
+
+			for _, d := range options {
+				if d.String() == selected {
+					deployment = d
+				}
+			}
+		}
+
+		/*
+		 * Get an SSH client and start rolling back.
+		 */
+		spinner := rendering.Spinner(fmt.Sprintf("Getting SSH client for host '%s'", proj.Host))
+
+		if sshClient, contextInfo, err = sshutils.GetClientFromProject(proj); err != nil {
+			spinner.Fail(fmt.Sprintf("Unable to get SSH client for host '%s': %s", proj.Host, err.Error()))
+			os.Exit(1)
+		}
+
+		defer sshClient.Close()
+		spinner.Success("Connection established.")
+
+		executor := sshutils.NewGophExecutor(sshClient)
+
+		contextInfo.ImageTag = deployment.Tag()
+
+		if err = resolveColors(ctx, executor, proj, &contextInfo); err != nil {
+			rendering.Error("%s", err.Error())
+			os.Exit(1)
+		}
+
+		if debug {
+			rendering.Print("context: %+v", contextInfo)
+		}
+
+		if err = commands.RollbackApplicationCommand.Run(ctx, executor, contextInfo, debug); err != nil {
+			os.Exit(1)
+		}
+
+		if err = commands.SetupApplicationCommand.Run(ctx, executor, contextInfo, debug); err != nil {
+			os.Exit(1)
+		}
+
+		if err = startApplication(ctx, executor, proj, contextInfo, debug); err != nil {
+			os.Exit(1)
+		}
+
+		if err = proj.RollbackTo(deployment.Version); err != nil {
+			rendering.Error("Your application was rolled back, but there was a problem updating the local project file: %s", err)
+			os.Exit(1)
+		}
+
+		rendering.Header("⏪ Rolled back to version %d!", deployment.Version)
+	},
+}
+
+func init() {
+	rollbackCmd.Flags().BoolP("debug", "d", false, "Enable debug output")
+	rootCmd.AddCommand(rollbackCmd)
+}
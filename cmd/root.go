@@ -22,7 +22,10 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 )
@@ -45,9 +48,21 @@ a machine setup and your application running.`,
 /*
 Execute adds all child commands to the root command and sets flags appropriately.
 This is called by main.main(). It only needs to happen once to the rootCmd.
+
+The first Ctrl-C cancels the context commands get from cmd.Context(),
+which stops whatever is running on the server. A second one quits
+straight away.
 */
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
 	if err != nil {
 		os.Exit(1)
 	}
@@ -59,6 +74,7 @@ func init() {
 	// will be global for your application.
 
 	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.pusher.yaml)")
+	rootCmd.PersistentFlags().StringP("env", "e", "", "Environment from pusher.yaml to use, such as staging or production. Also set with PUSHER_ENV")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
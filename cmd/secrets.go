@@ -0,0 +1,309 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/adampresley/pusher/pkg/project"
+	"github.com/adampresley/pusher/pkg/rendering"
+	"github.com/adampresley/pusher/pkg/secrets"
+	"github.com/spf13/cobra"
+)
+
+var secretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Manage an encrypted env file",
+	Long: `Keep your env file in the repository, encrypted with age. Point
+'envfile' in pusher.yaml at a file ending in .age, such as
+.env.production.age, and list who can decrypt it under 'recipients'.`,
+}
+
+var secretsEditCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Edit the encrypted env file",
+	Long: `Decrypt the env file, open it in $VISUAL or $EDITOR, and encrypt
+it again for every recipient once you close the editor. If you don't
+have an age key yet one is created for you and added as a recipient.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			err        error
+			plaintext  []byte
+			edited     []byte
+			ciphertext []byte
+		)
+
+		proj := loadSecretsProject(cmd)
+
+		if err = ensureOwnRecipient(proj); err != nil {
+			rendering.Error("%s", err.Error())
+			os.Exit(1)
+		}
+
+		if _, err = os.Stat(proj.EnvFile); err == nil {
+			if plaintext, err = secrets.DecryptFile(proj.EnvFile); err != nil {
+				rendering.Error("%s", err.Error())
+				os.Exit(1)
+			}
+		}
+
+		if edited, err = editInTempFile(plaintext); err != nil {
+			rendering.Error("%s", err.Error())
+			os.Exit(1)
+		}
+
+		if bytes.Equal(plaintext, edited) {
+			rendering.Print("No changes made.")
+			return
+		}
+
+		if ciphertext, err = secrets.Encrypt(edited, proj.Recipients); err != nil {
+			rendering.Error("%s", err.Error())
+			os.Exit(1)
+		}
+
+		if err = os.WriteFile(proj.EnvFile, ciphertext, 0644); err != nil {
+			rendering.Error("There was a problem writing '%s': %s", proj.EnvFile, err.Error())
+			os.Exit(1)
+		}
+
+		rendering.Success("Saved '%s' for %d recipient(s).", proj.EnvFile, len(proj.Recipients))
+	},
+}
+
+var secretsAddRecipientCmd = &cobra.Command{
+	Use:   "add-recipient PUBLIC_KEY",
+	Short: "Let another age or SSH public key decrypt the env file",
+	Long: `Add an age public key (age1...) or an SSH public key
+(ssh-ed25519 ...) to the recipients in pusher.yaml, and encrypt the env
+file again so the new recipient can decrypt it.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			err       error
+			plaintext []byte
+		)
+
+		recipient := strings.TrimSpace(args[0])
+		proj := loadSecretsProject(cmd)
+
+		if _, err = secrets.ParseRecipients([]string{recipient}); err != nil {
+			rendering.Error("%s", err.Error())
+			os.Exit(1)
+		}
+
+		if slices.Contains(proj.Recipients, recipient) {
+			rendering.Warning("That recipient is already in %s.", project.PusherProjectFileName)
+			return
+		}
+
+		/*
+		 * Decrypt before changing anything, so we don't save a
+		 * recipient we can't actually encrypt the file for.
+		 */
+		_, statErr := os.Stat(proj.EnvFile)
+
+		if statErr == nil {
+			if plaintext, err = secrets.DecryptFile(proj.EnvFile); err != nil {
+				rendering.Error("%s", err.Error())
+				os.Exit(1)
+			}
+		}
+
+		proj.Recipients = append(proj.Recipients, recipient)
+
+		if statErr == nil {
+			if err = writeLocalEnvFile(proj, plaintext); err != nil {
+				rendering.Error("%s", err.Error())
+				os.Exit(1)
+			}
+		}
+
+		if err = proj.Save(); err != nil {
+			rendering.Error("There was a problem saving your project settings: %s", err.Error())
+			os.Exit(1)
+		}
+
+		rendering.Success("Added recipient. '%s' is now encrypted for %d recipient(s).", proj.EnvFile, len(proj.Recipients))
+	},
+}
+
+/*
+readLocalEnvFile returns the contents of the project's env file,
+decrypting it in memory when it is age encrypted.
+*/
+func readLocalEnvFile(proj *project.PusherProject) ([]byte, error) {
+	if proj.UsesEncryptedEnvFile() {
+		result, err := secrets.DecryptFile(proj.EnvFile)
+
+		if err != nil {
+			return nil, fmt.Errorf("There was a problem decrypting '%s': %s", proj.EnvFile, err.Error())
+		}
+
+		return result, nil
+	}
+
+	result, err := os.ReadFile(proj.EnvFile)
+
+	if err != nil {
+		return nil, fmt.Errorf("There was a problem reading env file '%s': %s", proj.EnvFile, err.Error())
+	}
+
+	return result, nil
+}
+
+/*
+writeLocalEnvFile saves the project's env file, encrypting it for the
+project's recipients when it is age encrypted.
+*/
+func writeLocalEnvFile(proj *project.PusherProject, contents []byte) error {
+	var err error
+
+	if proj.UsesEncryptedEnvFile() {
+		if contents, err = secrets.Encrypt(contents, proj.Recipients); err != nil {
+			return err
+		}
+
+		return os.WriteFile(proj.EnvFile, contents, 0644)
+	}
+
+	return os.WriteFile(proj.EnvFile, contents, 0600)
+}
+
+func loadSecretsProject(cmd *cobra.Command) *project.PusherProject {
+	proj, err := loadProject(cmd)
+
+	if err != nil {
+		rendering.Error("There was a problem loading your project configuration file: %s", err.Error())
+		os.Exit(1)
+	}
+
+	if !proj.UsesEncryptedEnvFile() {
+		rendering.Error("'envfile' in %s must end in '%s', for example '.env.production%s'.", project.PusherProjectFileName, secrets.EncryptedExtension, secrets.EncryptedExtension)
+		os.Exit(1)
+	}
+
+	return proj
+}
+
+/*
+ensureOwnRecipient makes sure there is at least one recipient. With none,
+the user's own age key is added, and created first if it doesn't exist.
+*/
+func ensureOwnRecipient(proj *project.PusherProject) error {
+	var (
+		err       error
+		publicKey string
+	)
+
+	if len(proj.Recipients) > 0 {
+		return nil
+	}
+
+	if _, err = os.Stat(secrets.IdentityFile()); os.IsNotExist(err) && os.Getenv("PUSHER_AGE_KEY") == "" {
+		if publicKey, err = secrets.GenerateIdentity(); err != nil {
+			return err
+		}
+
+		rendering.Success("Created a new age key in '%s'. Keep it safe, and out of the repository.", secrets.IdentityFile())
+	} else if publicKey, err = secrets.PublicKey(); err != nil {
+		return err
+	}
+
+	if publicKey == "" {
+		return fmt.Errorf("Add a recipient with 'pusher secrets add-recipient' first")
+	}
+
+	proj.Recipients = append(proj.Recipients, publicKey)
+
+	if err = proj.Save(); err != nil {
+		return fmt.Errorf("There was a problem saving your project settings: %s", err.Error())
+	}
+
+	rendering.Print("Added your public key %s to the recipients.", publicKey)
+	return nil
+}
+
+/*
+editInTempFile opens contents in the user's editor and returns what they
+saved. The temp file is only readable by the user, lives in memory
+where the system allows it, and is removed afterwards.
+*/
+func editInTempFile(contents []byte) ([]byte, error) {
+	var (
+		err error
+		f   *os.File
+	)
+
+	dir := ""
+
+	if info, statErr := os.Stat("/dev/shm"); statErr == nil && info.IsDir() {
+		dir = "/dev/shm"
+	}
+
+	if f, err = os.CreateTemp(dir, "pusher-secrets-*.env"); err != nil {
+		return nil, fmt.Errorf("Unable to create a temp file to edit: %s", err.Error())
+	}
+
+	defer os.Remove(f.Name())
+
+	if _, err = f.Write(contents); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	f.Close()
+
+	editor := os.Getenv("VISUAL")
+
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+
+	if editor == "" {
+		editor = "vi"
+	}
+
+	parts := strings.Fields(editor)
+	editorCmd := exec.Command(parts[0], append(parts[1:], f.Name())...)
+	editorCmd.Stdin = os.Stdin
+	editorCmd.Stdout = os.Stdout
+	editorCmd.Stderr = os.Stderr
+
+	if err = editorCmd.Run(); err != nil {
+		return nil, fmt.Errorf("The editor exited with an error: %s", err.Error())
+	}
+
+	return os.ReadFile(f.Name())
+}
+
+func init() {
+	secretsCmd.AddCommand(secretsEditCmd)
+	secretsCmd.AddCommand(secretsAddRecipientCmd)
+	rootCmd.AddCommand(secretsCmd)
+}
@@ -26,7 +26,6 @@ import (
 	"os"
 
 	"github.com/adampresley/pusher/pkg/contextinfo"
-	"github.com/adampresley/pusher/pkg/project"
 	"github.com/adampresley/pusher/pkg/rendering"
 	"github.com/adampresley/pusher/pkg/services"
 	"github.com/adampresley/pusher/pkg/sshutils"
@@ -50,6 +49,7 @@ var serviceCmd = &cobra.Command{
 		)
 
 		debug, _ := cmd.Flags().GetBool("debug")
+		ctx := cmd.Context()
 
 		if debug {
 			rendering.Print("Debug enabled.")
@@ -60,9 +60,9 @@ var serviceCmd = &cobra.Command{
 		/*
 		 * First load the project
 		 */
-		proj := &project.PusherProject{}
+		proj, err := loadProject(cmd)
 
-		if err = proj.Load(); err != nil {
+		if err != nil {
 			rendering.Error("There was a problem loading your project configuration file: %s", err.Error())
 			os.Exit(1)
 		}
@@ -106,7 +106,7 @@ var serviceCmd = &cobra.Command{
 		 */
 		selectedService.Collector(&contextInfo)
 
-		if err = selectedService.Step.Run(sshClient, contextInfo, debug); err != nil {
+		if err = selectedService.Step.Run(ctx, sshutils.NewGophExecutor(sshClient), contextInfo, debug); err != nil {
 			os.Exit(1)
 		}
 	},
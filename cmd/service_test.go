@@ -0,0 +1,81 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/adampresley/pusher/pkg/contextinfo"
+	"github.com/adampresley/pusher/pkg/services"
+	"github.com/adampresley/pusher/pkg/sshtest"
+	"github.com/adampresley/pusher/pkg/sshutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstallService(t *testing.T) {
+	tests := []struct {
+		name    string
+		service services.ServiceItem
+		env     map[string]string
+		want    []string
+	}{
+		{
+			name:    "postgres",
+			service: services.PostgresService,
+			env:     map[string]string{"POSTGRES_USER": "root", "POSTGRES_PASSWORD": "secret"},
+			want: []string{
+				"cd ~ && mkdir -p services/postgres/data",
+				"cd services/postgres && sudo docker compose up -d",
+			},
+		},
+		{
+			name:    "registry",
+			service: services.RegistryService,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := sshtest.NewServer(t)
+			info := contextinfo.ContextInfo{User: "pusher", Env: tt.env}
+
+			err := tt.service.Step.Run(context.Background(), sshutils.NewGophExecutor(server.Dial(t)), info, false)
+			assert.NoError(t, err)
+
+			got := server.Commands()
+			assert.Equal(t, stepCommands(info, tt.service.Step), got)
+
+			for _, command := range tt.want {
+				assert.Contains(t, got, command)
+			}
+		})
+	}
+}
+
+func TestInstallServiceWritesEnvironment(t *testing.T) {
+	server := sshtest.NewServer(t)
+	info := contextinfo.ContextInfo{Env: map[string]string{"POSTGRES_USER": "root", "POSTGRES_DB": "app"}}
+
+	assert.NoError(t, services.PostgresService.Step.Run(context.Background(), sshutils.NewGophExecutor(server.Dial(t)), info, false))
+	assert.Contains(t, server.Commands()[1], "    environment:\n      POSTGRES_DB: \"app\"\n      POSTGRES_USER: \"root\"\n")
+}
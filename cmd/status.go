@@ -0,0 +1,275 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adampresley/pusher/pkg/contextinfo"
+	"github.com/adampresley/pusher/pkg/project"
+	"github.com/adampresley/pusher/pkg/rendering"
+	"github.com/adampresley/pusher/pkg/sshutils"
+	"github.com/adampresley/pusher/pkg/status"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the state of your application and server",
+	Long: `Show the state of your application's container, Traefik and
+your domain's certificate, and the services installed on the server.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			err    error
+			report status.Report
+		)
+
+		debug, _ := cmd.Flags().GetBool("debug")
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+
+		/*
+		 * JSON goes to stdout for scripts, so keep everything else quiet
+		 * unless something goes wrong.
+		 */
+		fail := func(message string, args ...any) {
+			pterm.EnableOutput()
+			rendering.Error(message, args...)
+			os.Exit(1)
+		}
+
+		if jsonOutput {
+			pterm.DisableOutput()
+		}
+
+		if debug {
+			rendering.Print("Debug enabled.")
+		}
+
+		proj, err := loadProject(cmd)
+
+		if err != nil {
+			fail("There was a problem loading your project configuration file: %s", err.Error())
+		}
+
+		sshClient, contextInfo := connectToProject(proj)
+		defer sshClient.Close()
+
+		spinner := rendering.Spinner(fmt.Sprintf("Getting status from '%s'", proj.Host))
+
+		if report, err = getStatusReport(cmd.Context(), sshutils.NewGophExecutor(sshClient), proj, contextInfo, debug); err != nil {
+			spinner.Fail()
+			fail("%s", err.Error())
+		}
+
+		spinner.Success("Status retrieved.")
+
+		if jsonOutput {
+			b, _ := json.MarshalIndent(report, "", "  ")
+			fmt.Println(string(b))
+			return
+		}
+
+		printStatusReport(proj, report)
+	},
+}
+
+func getStatusReport(ctx context.Context, executor sshutils.Executor, proj *project.PusherProject, info contextinfo.ContextInfo, debug bool) (status.Report, error) {
+	var (
+		err        error
+		b          []byte
+		containers []status.ContainerStatus
+	)
+
+	run := func(command string) ([]byte, error) {
+		if debug {
+			rendering.Print("COMMAND: %s", command)
+		}
+
+		return executor.Run(ctx, command)
+	}
+
+	result := status.Report{
+		Version:       proj.Version,
+		ActiveVersion: proj.ActiveVersion,
+	}
+
+	if err = resolveActiveColor(ctx, executor, proj, &info); err != nil {
+		return result, err
+	}
+
+	appContainer := proj.ServiceName
+
+	if info.Color != "" {
+		appContainer += "-" + info.Color
+	}
+
+	/*
+	 * Every directory in ~/services is a service installed with
+	 * 'pusher service', and its container has the same name.
+	 */
+	if b, err = run("ls -1 ~/services 2>/dev/null || true"); err != nil {
+		return result, fmt.Errorf("Unable to list installed services: %s", err.Error())
+	}
+
+	names := append([]string{appContainer, "traefik"}, strings.Fields(string(b))...)
+
+	/*
+	 * docker inspect fails for containers that don't exist, so only the
+	 * ones that do are inspected, and any failure is a real one.
+	 */
+	if b, err = run("sudo docker ps -a --format '{{.Names}}'"); err != nil {
+		return result, fmt.Errorf("Unable to list containers: %s", err.Error())
+	}
+
+	existing := strings.Fields(string(b))
+	quoted := []string{}
+
+	for _, name := range names {
+		if slices.Contains(existing, name) {
+			quoted = append(quoted, info.Quote(name))
+		}
+	}
+
+	inspectOutput := []byte{}
+
+	if len(quoted) > 0 {
+		if inspectOutput, err = run("sudo docker inspect " + strings.Join(quoted, " ")); err != nil {
+			return result, fmt.Errorf("Unable to inspect containers: %s", err.Error())
+		}
+	}
+
+	running := []string{}
+
+	if containers, err = status.ParseContainers(names, inspectOutput, nil, time.Now()); err != nil {
+		return result, err
+	}
+
+	for _, c := range containers {
+		if c.State == "running" {
+			running = append(running, info.Quote(c.Name))
+		}
+	}
+
+	if len(running) > 0 {
+		if b, err = run("sudo docker stats --no-stream --format '{{json .}}' " + strings.Join(running, " ") + " 2>/dev/null || true"); err != nil {
+			return result, fmt.Errorf("Unable to get container stats: %s", err.Error())
+		}
+
+		if containers, err = status.ParseContainers(names, inspectOutput, b, time.Now()); err != nil {
+			return result, err
+		}
+	}
+
+	result.Application = containers[0]
+	result.Traefik.Container = containers[1]
+	result.Services = containers[2:]
+
+	/*
+	 * A rollback leaves Version alone and moves ActiveVersion back, so
+	 * that is the one the container should be running.
+	 */
+	result.ExpectedVersion = proj.ActiveVersion
+
+	if result.ExpectedVersion == 0 {
+		result.ExpectedVersion = proj.Version
+	}
+
+	result.UpToDate = result.Application.ImageTag == strconv.Itoa(result.ExpectedVersion)
+
+	/*
+	 * Ask Traefik for the domain from the server itself, so DNS doesn't
+	 * get in the way, then read the certificate it serves.
+	 */
+	if proj.Domain != "" {
+		domain := info.Quote(proj.Domain)
+		result.Traefik.Domain = proj.Domain
+
+		if b, err = run("curl -sk -o /dev/null -w '%{http_code}' --max-time 5 --resolve " + info.Quote(proj.Domain+":443:127.0.0.1") + " https://" + domain + "/ || true"); err == nil {
+			result.Traefik.RouterStatus, _ = strconv.Atoi(strings.TrimSpace(string(b)))
+		}
+
+		result.Traefik.Router = status.DescribeRouter(result.Traefik.RouterStatus)
+
+		if b, err = run("echo | timeout 5 openssl s_client -servername " + domain + " -connect 127.0.0.1:443 2>/dev/null | openssl x509 -noout -enddate -issuer 2>/dev/null || true"); err == nil {
+			status.ParseCertificate(b, &result.Traefik, time.Now())
+		}
+	}
+
+	return result, nil
+}
+
+func printStatusReport(proj *project.PusherProject, report status.Report) {
+	rows := [][]string{{"Container", "State", "Uptime", "Restarts", "Image", "CPU", "Memory"}}
+	containers := append([]status.ContainerStatus{report.Application, report.Traefik.Container}, report.Services...)
+
+	for _, c := range containers {
+		state := c.State
+
+		if c.Health != "" {
+			state += " (" + c.Health + ")"
+		}
+
+		rows = append(rows, []string{c.Name, state, c.Uptime, strconv.Itoa(c.Restarts), c.Image, c.CPU, c.Memory})
+	}
+
+	rendering.Table(rows)
+	rendering.BlankLine()
+
+	if report.UpToDate {
+		rendering.Success("Running version %s, as recorded in %s.", report.Application.ImageTag, project.PusherProjectFileName)
+	} else {
+		rendering.Warning("Running image '%s', but %s expects version %d.", report.Application.Image, project.PusherProjectFileName, report.ExpectedVersion)
+	}
+
+	if proj.Domain == "" {
+		return
+	}
+
+	certificate := "none"
+	expires := ""
+
+	if report.Traefik.CertificateIssuer != "" {
+		certificate = report.Traefik.CertificateIssuer
+		expires = fmt.Sprintf("%s (%d days)", report.Traefik.CertificateExpires.Format("2006-01-02"), report.Traefik.CertificateDays)
+	}
+
+	rendering.BlankLine()
+	rendering.Table([][]string{
+		{"Domain", "Router", "Certificate", "Expires"},
+		{report.Traefik.Domain, report.Traefik.Router, certificate, expires},
+	})
+}
+
+func init() {
+	statusCmd.Flags().BoolP("debug", "d", false, "Enable debug output")
+	statusCmd.Flags().Bool("json", false, "Print the status as JSON")
+	rootCmd.AddCommand(statusCmd)
+}
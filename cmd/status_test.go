@@ -0,0 +1,75 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/adampresley/pusher/pkg/sshtest"
+	"github.com/adampresley/pusher/pkg/status"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetStatusReportInspectsExistingContainers(t *testing.T) {
+	proj := newTestProject(t)
+	proj.Domain = ""
+
+	recorder := &sshtest.Recorder{
+		Handler: func(command string, stdin []byte) (string, int) {
+			switch {
+			case strings.HasPrefix(command, "sudo docker ps"):
+				return "myapp\nsomething-else\n", 0
+
+			case strings.HasPrefix(command, "sudo docker inspect"):
+				return `[{"Name": "/myapp", "State": {"Status": "exited"}, "Config": {"Image": "myapp:3"}}]`, 0
+			}
+
+			return "", 0
+		},
+	}
+
+	report, err := getStatusReport(context.Background(), recorder, proj, newTestContext(proj), false)
+	assert.NoError(t, err)
+
+	assert.Contains(t, recorder.Commands(), "sudo docker inspect 'myapp'", "traefik doesn't exist, so it isn't inspected")
+	assert.Equal(t, "exited", report.Application.State)
+	assert.Equal(t, status.StateMissing, report.Traefik.Container.State)
+}
+
+func TestGetStatusReportFailsWhenDockerFails(t *testing.T) {
+	proj := newTestProject(t)
+
+	recorder := &sshtest.Recorder{
+		Handler: func(command string, stdin []byte) (string, int) {
+			if strings.HasPrefix(command, "sudo docker ps") {
+				return "permission denied while trying to connect to the Docker daemon socket", 1
+			}
+
+			return "", 0
+		},
+	}
+
+	_, err := getStatusReport(context.Background(), recorder, proj, newTestContext(proj), false)
+	assert.ErrorContains(t, err, "Unable to list containers")
+}
@@ -0,0 +1,168 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/adampresley/pusher/pkg/contextinfo"
+	"github.com/adampresley/pusher/pkg/rendering"
+	"github.com/adampresley/pusher/pkg/services"
+	"github.com/adampresley/pusher/pkg/sshutils"
+	"github.com/spf13/cobra"
+)
+
+var tunnelCmd = &cobra.Command{
+	Use:   "tunnel SERVICE|REMOTE_PORT",
+	Short: "Forward a local port to a service on your server",
+	Long: `Services such as Postgres only listen on the server's loopback
+address. tunnel opens a local port and forwards connections to them over
+SSH until you press Ctrl-C.`,
+	Example: `  pusher tunnel postgres
+  pusher tunnel postgres --local-port 5433
+  pusher tunnel 6379`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			err        error
+			remotePort int
+			service    services.ServiceItem
+			isService  bool
+		)
+
+		localPort, _ := cmd.Flags().GetInt("local-port")
+
+		/*
+		 * Either a service we know the port of, or a port number. Known
+		 * services default to a local port 10000 higher than their own,
+		 * so they don't clash with one running on this machine.
+		 */
+		if remotePort, err = strconv.Atoi(args[0]); err != nil {
+			if service, isService = services.GetServiceByContainer(args[0]); !isService {
+				rendering.Error("'%s' is not a port number or a known service. Known services: %s", args[0], strings.Join(knownServiceContainers(), ", "))
+				os.Exit(1)
+			}
+
+			remotePort = service.Port
+
+			if localPort == 0 {
+				localPort = remotePort + 10000
+			}
+		}
+
+		if localPort == 0 {
+			localPort = remotePort
+		}
+
+		proj, err := loadProject(cmd)
+
+		if err != nil {
+			rendering.Error("There was a problem loading your project configuration file: %s", err.Error())
+			os.Exit(1)
+		}
+
+		if proj.Host == "" {
+			rendering.Error("This project has no host yet. Run 'pusher prepare' first.")
+			os.Exit(1)
+		}
+
+		sshClient, contextInfo := connectToProject(proj)
+		defer sshClient.Close()
+
+		tunnel, err := sshutils.OpenTunnel(sshClient, fmt.Sprintf("127.0.0.1:%d", localPort), fmt.Sprintf("127.0.0.1:%d", remotePort))
+
+		if err != nil {
+			rendering.Error("%s", err.Error())
+			os.Exit(1)
+		}
+
+		defer tunnel.Close()
+
+		rendering.Success("Forwarding localhost:%d to port %d on '%s'.", localPort, remotePort, proj.Host)
+
+		if isService && service.ConnectionString != nil {
+			printConnectionString(cmd.Context(), sshutils.NewGophExecutor(sshClient), contextInfo, service, localPort)
+		}
+
+		rendering.Print("Press Ctrl-C to stop.")
+
+		disconnected := make(chan error, 1)
+
+		go func() {
+			disconnected <- sshClient.Wait()
+		}()
+
+		select {
+		case <-cmd.Context().Done():
+			rendering.BlankLine()
+			rendering.Print("Closing tunnel.")
+
+		case <-disconnected:
+			rendering.Error("The connection to '%s' was lost.", proj.Host)
+			os.Exit(1)
+		}
+	},
+}
+
+/*
+printConnectionString shows how to connect to service through the
+tunnel, using the settings in its compose file on the server.
+*/
+func printConnectionString(ctx context.Context, executor sshutils.Executor, info contextinfo.ContextInfo, service services.ServiceItem, localPort int) {
+	composeFile := "~/services/" + service.Container + "/docker-compose.yml"
+	b, err := executor.Run(ctx, "cat "+info.QuotePath(composeFile))
+
+	if err != nil {
+		rendering.Warning("Unable to read '%s' for the connection details: %s", composeFile, err.Error())
+		return
+	}
+
+	env, err := services.ComposeEnvironment(b, service.Container)
+
+	if err != nil {
+		rendering.Warning("Unable to read the connection details from '%s': %s", composeFile, err.Error())
+		return
+	}
+
+	rendering.Print("Connect with: %s", service.ConnectionString(env, localPort))
+}
+
+func knownServiceContainers() []string {
+	result := []string{}
+
+	for _, item := range services.ServiceList {
+		if item.Container != "" {
+			result = append(result, item.Container)
+		}
+	}
+
+	return result
+}
+
+func init() {
+	tunnelCmd.Flags().Int("local-port", 0, "Local port to listen on. Defaults to the remote port, or 10000 higher for known services")
+	rootCmd.AddCommand(tunnelCmd)
+}
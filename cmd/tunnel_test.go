@@ -0,0 +1,58 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/adampresley/pusher/pkg/services"
+	"github.com/adampresley/pusher/pkg/sshtest"
+	"github.com/pterm/pterm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintConnectionStringWarnsWhenComposeFileIsUnreadable(t *testing.T) {
+	output := &bytes.Buffer{}
+	pterm.EnableOutput()
+	pterm.SetDefaultOutput(output)
+
+	defer func() {
+		pterm.SetDefaultOutput(os.Stdout)
+		pterm.DisableOutput()
+	}()
+
+	service, _ := services.GetServiceByContainer("postgres")
+	recorder := &sshtest.Recorder{
+		Handler: func(command string, stdin []byte) (string, int) {
+			return "cat: docker-compose.yml: No such file or directory", 1
+		},
+	}
+
+	printConnectionString(context.Background(), recorder, newTestContext(newTestProject(t)), service, 15432)
+
+	assert.Equal(t, []string{`cat "$HOME"/'services/postgres/docker-compose.yml'`}, recorder.Commands())
+	assert.Contains(t, output.String(), "Unable to read '~/services/postgres/docker-compose.yml'")
+	assert.NotContains(t, output.String(), "Connect with")
+}
@@ -0,0 +1,40 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package commands
+
+import "github.com/adampresley/pusher/pkg/sshutils"
+
+/*
+CreateMountDirectoriesCommand creates the server side folders of the
+application's mounts that don't exist yet.
+*/
+var CreateMountDirectoriesCommand = sshutils.Step{
+	Commands: []sshutils.Command{
+		sshutils.NewCommand(
+			`{{range .MountDirectories}}mkdir -p -- {{$.QuotePath .}} && {{end}}true`,
+			"Creating mount folders...",
+		),
+	},
+	StartingMessage: "Creating any missing mount folders...",
+	SuccessMessage:  "Mount folders created.",
+	ErrorMessage:    "Unable to create local mount folder on the server: %s",
+}
@@ -0,0 +1,52 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package commands
+
+import "github.com/adampresley/pusher/pkg/sshutils"
+
+/*
+DestroyApplicationCommand removes everything a deploy put on the server:
+the containers of every colour, the application's images, and the
+application folder. Traefik drops the application's routers along with
+its containers, but its certificate is removed separately, as that means
+editing acme.json. Mount folders are left alone; see
+RemoveMountDirectoriesCommand.
+*/
+var DestroyApplicationCommand = sshutils.Step{
+	Commands: []sshutils.Command{
+		sshutils.NewCommand(
+			`if [ -d ~/applications/{{.ServiceName}} ]; then cd ~/applications/{{.ServiceName}} && for c in blue green; do if [ -f docker-compose.$c.yml ]; then sudo docker compose -p {{.ServiceName}}-$c -f docker-compose.$c.yml down --remove-orphans; fi; done && if [ -f docker-compose.yml ]; then sudo docker compose -f docker-compose.yml down --remove-orphans; fi; fi`,
+			"Removing containers...",
+		),
+		sshutils.NewCommand(
+			`sudo docker images --filter reference={{.Quote .ServiceName}} --filter reference='*/'{{.Quote .ServiceName}} --filter reference='*/*/'{{.Quote .ServiceName}} --format '{{"{{.Repository}}:{{.Tag}}"}}' | xargs -r sudo docker rmi || true`,
+			"Removing images...",
+		),
+		sshutils.NewCommand(
+			`rm -rf ~/applications/{{.ServiceName}}`,
+			"Removing application folder...",
+		),
+	},
+	StartingMessage: "Destroying your application...",
+	SuccessMessage:  "Application destroyed.",
+	ErrorMessage:    "There was a problem destroying your application: %s",
+}
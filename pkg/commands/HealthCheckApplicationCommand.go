@@ -0,0 +1,48 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package commands
+
+import "github.com/adampresley/pusher/pkg/sshutils"
+
+/*
+HealthCheckApplicationCommand requests the configured health check path
+from the server until it answers with the expected status, or the
+retries run out. Standard deploys are reached on 127.0.0.1, blue/green
+deploys on the new container's address since their port is not published.
+*/
+var HealthCheckApplicationCommand = sshutils.Step{
+	Commands: []sshutils.Command{
+		sshutils.NewCommand(
+			`host={{if .Color}}$(docker inspect -f '{{"{{range .NetworkSettings.Networks}}{{.IPAddress}}{{end}}"}}' {{.ServiceName}}-{{.Color}}){{else}}127.0.0.1{{end}}
+for i in $(seq 1 {{.HealthCheck.Retries}}); do
+  status=$(curl -s -o /dev/null -w '%{http_code}' --max-time {{.HealthCheck.Timeout}} "http://$host:{{.Port}}"{{.Quote .HealthCheck.Path}})
+  [ "$status" = "{{.HealthCheck.ExpectedStatus}}" ] && exit 0
+  sleep 3
+done
+echo "expected status {{.HealthCheck.ExpectedStatus}} from "{{.Quote .HealthCheck.Path}}", got $status"; exit 1`,
+			"Checking application health...",
+		),
+	},
+	StartingMessage: "Checking application health...",
+	SuccessMessage:  "Application is healthy.",
+	ErrorMessage:    "The application failed its health check: %s",
+}
@@ -0,0 +1,40 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package commands
+
+import "github.com/adampresley/pusher/pkg/sshutils"
+
+/*
+PruneApplicationImagesCommand removes all but the newest KeepImages
+versioned images of the application from the server.
+*/
+var PruneApplicationImagesCommand = sshutils.Step{
+	Commands: []sshutils.Command{
+		sshutils.NewCommand(
+			`sudo docker images {{.ServiceName}} --format '{{"{{.Tag}}"}}' | grep -E '^[0-9]+$' | sort -rn | sed '1,{{.KeepImages}}d' | xargs -r -I{} sudo docker rmi {{.ServiceName}}:{} || true`,
+			"Removing old application images...",
+		),
+	},
+	StartingMessage: "Removing old application images...",
+	SuccessMessage:  "Old application images removed.",
+	ErrorMessage:    "There was a problem removing old application images: %s",
+}
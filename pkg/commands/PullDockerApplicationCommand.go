@@ -0,0 +1,49 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package commands
+
+import (
+	"time"
+
+	"github.com/adampresley/pusher/pkg/sshutils"
+)
+
+/*
+PullDockerApplicationCommand pulls the application image from a registry
+and tags it with the same local names a tarball upload would have, so
+the compose file, pruning, and rollback work the same either way.
+*/
+var PullDockerApplicationCommand = sshutils.Step{
+	Commands: []sshutils.Command{
+		sshutils.NewCommand(
+			`sudo docker pull {{.Registry}}/{{.ServiceName}}:{{.ImageTag}}`,
+			"Pulling application...",
+		).WithRetry(sshutils.NetworkRetry).WithTimeout(15 * time.Minute),
+		sshutils.NewCommand(
+			`sudo docker tag {{.Registry}}/{{.ServiceName}}:{{.ImageTag}} {{.ServiceName}}:{{.ImageTag}} && sudo docker tag {{.Registry}}/{{.ServiceName}}:{{.ImageTag}} {{.ServiceName}}:latest && sudo docker rmi {{.Registry}}/{{.ServiceName}}:{{.ImageTag}}`,
+			"Tagging application...",
+		),
+	},
+	StartingMessage: "Pulling your application...",
+	SuccessMessage:  "Application pulled successfully.",
+	ErrorMessage:    "There was a problem pulling your application: %s",
+}
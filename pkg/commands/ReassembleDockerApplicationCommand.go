@@ -0,0 +1,60 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package commands
+
+import "github.com/adampresley/pusher/pkg/sshutils"
+
+/*
+ReassembleDockerApplicationCommand puts layers that were left out of an
+uploaded image archive back in, copying them from a `docker save` of the
+image currently on the server, so the archive can be loaded normally.
+Archives with nothing left out are not changed.
+*/
+var ReassembleDockerApplicationCommand = sshutils.Step{
+	Commands: []sshutils.Command{
+		sshutils.NewCommand(
+			`cd ~/applications/{{.ServiceName}} && rm -rf .pusher-image && mkdir -p .pusher-image/new .pusher-image/previous && tar -xf {{.ServiceName}}-latest.tar -C .pusher-image/new`,
+			"Unpacking application...",
+		),
+		sshutils.NewCommand(
+			`cd ~/applications/{{.ServiceName}}/.pusher-image && if [ -f new/pusher-layers.txt ]; then
+  docker save {{.ServiceName}}:latest | tar -x -C previous || exit 1
+  (cd previous && find . -type f -exec sha256sum {} +) > previous.sums
+  while read -r layer digest; do
+    src=$(grep -m 1 "^$digest " previous.sums | awk '{print $2}')
+    [ -n "$src" ] || { echo "layer $digest was not found on the server"; exit 1; }
+    mkdir -p "$(dirname "new/$layer")" && ln -f "previous/$src" "new/$layer" || exit 1
+  done < new/pusher-layers.txt
+  rm new/pusher-layers.txt
+  tar -cf ../{{.ServiceName}}-latest.tar -C new .
+fi`,
+			"Restoring layers already on the server...",
+		),
+		sshutils.NewCommand(
+			`cd ~/applications/{{.ServiceName}} && rm -rf .pusher-image`,
+			"Cleaning up...",
+		),
+	},
+	StartingMessage: "Reassembling your application image...",
+	SuccessMessage:  "Application image reassembled.",
+	ErrorMessage:    "There was a problem reassembling your application image: %s",
+}
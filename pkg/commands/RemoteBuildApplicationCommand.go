@@ -0,0 +1,47 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package commands
+
+import "github.com/adampresley/pusher/pkg/sshutils"
+
+/*
+SyncBuildContextCommand replaces the application's build context on the
+server with a gzipped tar read from standard input. Run it with
+sshutils.Stream.
+*/
+const SyncBuildContextCommand string = `rm -rf ~/applications/{{.ServiceName}}/src && mkdir -p ~/applications/{{.ServiceName}}/src && tar -xzf - -C ~/applications/{{.ServiceName}}/src`
+
+/*
+RemoteBuildApplicationCommand builds the application image on the server
+from the build context synced to ~/applications/<name>/src.
+*/
+var RemoteBuildApplicationCommand = sshutils.Step{
+	Commands: []sshutils.Command{
+		sshutils.NewCommand(
+			`cd ~/applications/{{.ServiceName}}/src && docker build --cache-from={{.ServiceName}}:latest --tag {{.ServiceName}}:latest --tag {{.ServiceName}}:{{.ImageTag}}{{with .DockerBuild}} --platform {{.Platform}}{{if .Dockerfile}} --file {{$.Quote .Dockerfile}}{{end}}{{if .Target}} --target {{$.Quote .Target}}{{end}}{{range .BuildArgs}} --build-arg {{$.Quote .}}{{end}}{{end}} .`,
+			"Building application...",
+		),
+	},
+	StartingMessage: "Building your application on the server...",
+	SuccessMessage:  "Application built successfully.",
+	ErrorMessage:    "There was a problem building your application: %s",
+}
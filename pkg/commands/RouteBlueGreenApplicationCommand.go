@@ -0,0 +1,47 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package commands
+
+import "github.com/adampresley/pusher/pkg/sshutils"
+
+/*
+RouteBlueGreenApplicationCommand turns on the Traefik router of a colour
+that has passed its checks. Docker labels can't change on a running
+container, so the container is recreated with the router enabled and
+waited on again. Its router has a higher priority than the active
+colour's, so traffic moves over once it is back up.
+*/
+var RouteBlueGreenApplicationCommand = sshutils.Step{
+	Commands: []sshutils.Command{
+		sshutils.NewCommand(
+			`cd ~/applications/{{.ServiceName}} && sed -i 's/traefik.enable=false/traefik.enable=true/' docker-compose.{{.Color}}.yml && sudo docker compose -p {{.ServiceName}}-{{.Color}} -f docker-compose.{{.Color}}.yml up -d`,
+			"Routing traffic to new container...",
+		),
+		sshutils.NewCommand(
+			waitForColorScript,
+			"Waiting for new container to come back up...",
+		),
+	},
+	StartingMessage: "Routing traffic to new container...",
+	SuccessMessage:  "New container is receiving traffic.",
+	ErrorMessage:    "There was a problem routing traffic to the new container: %s",
+}
@@ -23,6 +23,12 @@ package commands
 
 import "github.com/adampresley/pusher/pkg/sshutils"
 
+/*
+SetupApplicationCommand writes the application's compose file. A
+blue/green colour is written with its Traefik router disabled until
+Live is set, so a new colour gets no traffic before it passes its
+checks. RouteBlueGreenApplicationCommand turns the router on.
+*/
 var SetupApplicationCommand = sshutils.Step{
 	Commands: []sshutils.Command{
 		sshutils.NewCommand(
@@ -30,14 +36,14 @@ var SetupApplicationCommand = sshutils.Step{
 			"Preparing {{.ServiceName}}...",
 		),
 		sshutils.NewCommand(
-			`cd ~/applications/{{.ServiceName}} && tee docker-compose.yml <<EOF
+			`cd ~/applications/{{.ServiceName}} && tee docker-compose{{if .Color}}.{{.Color}}{{end}}.yml <<EOF
 services:
   {{.ServiceName}}:
-    image: {{.ServiceName}}:latest
-    container_name: {{.ServiceName}}
-    restart: unless-stopped
+    image: {{.ServiceName}}:{{or .ImageTag "latest"}}
+    container_name: {{.ServiceName}}{{if .Color}}-{{.Color}}{{end}}
+    restart: unless-stopped{{if not .Color}}
     ports:
-      - 127.0.0.1:{{.Port}}:{{.Port}}
+      - 127.0.0.1:{{.Port}}:{{.Port}}{{end}}
     env_file:
       - {{.EnvFile}}{{if len .Dependencies}}
     depends_on:{{range .Dependencies}}
@@ -47,11 +53,12 @@ services:
     networks:
       - applications
     labels:
-      - traefik.enable=true
-      - traefik.http.routers.{{.ServiceName}}.rule=Host("{{.Domain}}")
-      - traefik.http.services.{{.ServiceName}}.loadbalancer.server.port={{.Port}}
-      - traefik.http.routers.{{.ServiceName}}.tls=true
-      - traefik.http.routers.{{.ServiceName}}.tls.certresolver=default
+      - traefik.enable={{if or (not .Color) .Live}}true{{else}}false{{end}}
+      - traefik.http.routers.{{.ServiceName}}{{if .Color}}-{{.Color}}{{end}}.rule=Host("{{.Domain}}")
+      - traefik.http.services.{{.ServiceName}}{{if .Color}}-{{.Color}}{{end}}.loadbalancer.server.port={{.Port}}
+      - traefik.http.routers.{{.ServiceName}}{{if .Color}}-{{.Color}}{{end}}.tls=true
+      - traefik.http.routers.{{.ServiceName}}{{if .Color}}-{{.Color}}{{end}}.tls.certresolver=default{{if .Color}}
+      - traefik.http.routers.{{.ServiceName}}-{{.Color}}.priority={{.Priority}}{{end}}
       - traefik.docker.network=applications
 
 networks:
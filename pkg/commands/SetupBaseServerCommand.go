@@ -21,22 +21,35 @@ THE SOFTWARE.
 */
 package commands
 
-import "github.com/adampresley/pusher/pkg/sshutils"
+import (
+	"time"
+
+	"github.com/adampresley/pusher/pkg/sshutils"
+)
+
+const (
+	/*
+	 * A timed out apt command can keep running on the server and hold the
+	 * dpkg lock, so the retry waits this many seconds for it instead of
+	 * failing right away.
+	 */
+	aptLockTimeout string = "600"
+)
 
 var SetupBaseServerCommand = sshutils.Step{
 	Commands: []sshutils.Command{
 		sshutils.NewCommand(
-			"sudo apt update -y",
+			"sudo apt -o DPkg::Lock::Timeout="+aptLockTimeout+" update -y",
 			"Updating packages list...",
-		),
+		).WithRetry(sshutils.NetworkRetry).WithTimeout(10 * time.Minute),
 		sshutils.NewCommand(
-			"sudo apt upgrade -y",
+			"sudo apt -o DPkg::Lock::Timeout="+aptLockTimeout+" upgrade -y",
 			"Upgrading OS packages...",
-		),
+		).WithRetry(sshutils.NetworkRetry).WithTimeout(30 * time.Minute),
 		sshutils.NewCommand(
-			"sudo apt install ca-certificates curl wget htop neovim git -y",
+			"sudo apt -o DPkg::Lock::Timeout="+aptLockTimeout+" install ca-certificates curl wget htop neovim git zstd -y",
 			"Installing additional packages...",
-		),
+		).WithRetry(sshutils.NetworkRetry).WithTimeout(15 * time.Minute),
 		sshutils.NewCommand(
 			"cd ~ && mkdir -p /applications/ && mkdir -p /services/",
 			"Setting up directories...",
@@ -45,4 +58,5 @@ var SetupBaseServerCommand = sshutils.Step{
 	StartingMessage: "Updating OS and installing base software components...",
 	SuccessMessage:  "Server update and software installed successfully.",
 	ErrorMessage:    "There was a problem updating the OS and installing software components: %s",
+	Timeout:         time.Hour,
 }
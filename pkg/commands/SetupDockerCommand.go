@@ -21,7 +21,11 @@ THE SOFTWARE.
 */
 package commands
 
-import "github.com/adampresley/pusher/pkg/sshutils"
+import (
+	"time"
+
+	"github.com/adampresley/pusher/pkg/sshutils"
+)
 
 const (
 	lazyDockerVersion string = "0.23.3"
@@ -36,7 +40,7 @@ var SetupDockerCommand = sshutils.Step{
 		sshutils.NewCommand(
 			"sudo curl -fsSL https://download.docker.com/linux/ubuntu/gpg -o /etc/apt/keyrings/docker.asc",
 			"Setting up keyring...",
-		),
+		).WithRetry(sshutils.NetworkRetry).WithTimeout(10 * time.Minute),
 		sshutils.NewCommand(
 			"sudo chmod a+r /etc/apt/keyrings/docker.asc",
 			"Setting up keyring...",
@@ -49,13 +53,13 @@ var SetupDockerCommand = sshutils.Step{
 			"Setting up keyring...",
 		),
 		sshutils.NewCommand(
-			"sudo apt update -y",
+			"sudo apt -o DPkg::Lock::Timeout="+aptLockTimeout+" update -y",
 			"Updating package list...",
-		),
+		).WithRetry(sshutils.NetworkRetry).WithTimeout(10 * time.Minute),
 		sshutils.NewCommand(
-			"sudo apt install docker-ce docker-ce-cli containerd.io docker-buildx-plugin docker-compose-plugin -y",
+			"sudo apt -o DPkg::Lock::Timeout="+aptLockTimeout+" install docker-ce docker-ce-cli containerd.io docker-buildx-plugin docker-compose-plugin -y",
 			"Installing Docker...",
-		),
+		).WithRetry(sshutils.NetworkRetry).WithTimeout(15 * time.Minute),
 		sshutils.NewCommand(
 			"sudo usermod -aG docker {{.User}}",
 			"Adding user to 'docker' group...",
@@ -65,9 +69,9 @@ var SetupDockerCommand = sshutils.Step{
 			"Setting up Docker network...",
 		),
 		sshutils.NewCommand(
-			`cd ~ && wget https://github.com/jesseduffield/lazydocker/releases/download/v`+lazyDockerVersion+`/lazydocker_`+lazyDockerVersion+`_Linux_x86_64.tar.gz`,
+			`cd ~ && wget -O lazydocker_`+lazyDockerVersion+`_Linux_x86_64.tar.gz https://github.com/jesseduffield/lazydocker/releases/download/v`+lazyDockerVersion+`/lazydocker_`+lazyDockerVersion+`_Linux_x86_64.tar.gz`,
 			"Installing LazyDocker...",
-		),
+		).WithRetry(sshutils.NetworkRetry).WithTimeout(10 * time.Minute),
 		sshutils.NewCommand(
 			`cd ~ && mkdir -p ./lazydocker && tar xvf ./lazydocker_`+lazyDockerVersion+`_Linux_x86_64.tar.gz -C ./lazydocker && sudo ln -sf ~/lazydocker/lazydocker /usr/local/bin/lazydocker`,
 			"Installing LazyDocker...",
@@ -80,4 +84,5 @@ var SetupDockerCommand = sshutils.Step{
 	StartingMessage: "Setting up Docker...",
 	SuccessMessage:  "Docker setup successfully.",
 	ErrorMessage:    "There was a problem setting up Docker: %s",
+	Timeout:         45 * time.Minute,
 }
@@ -21,7 +21,11 @@ THE SOFTWARE.
 */
 package commands
 
-import "github.com/adampresley/pusher/pkg/sshutils"
+import (
+	"time"
+
+	"github.com/adampresley/pusher/pkg/sshutils"
+)
 
 const (
 	PostgresVersion string = "15.2"
@@ -58,7 +62,7 @@ EOF`,
 		sshutils.NewCommand(
 			`cd services/postgres && sudo docker compose up -d`,
 			"Starting PostgreSQL...",
-		),
+		).WithRetry(sshutils.NetworkRetry).WithTimeout(10 * time.Minute),
 	},
 	StartingMessage: "Setting up PostgreSQL...",
 	SuccessMessage:  "PostgreSQL setup successfully.",
@@ -0,0 +1,67 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package commands
+
+import (
+	"time"
+
+	"github.com/adampresley/pusher/pkg/sshutils"
+)
+
+const (
+	RegistryVersion string = "2"
+)
+
+/*
+SetupServiceRegistryCommand runs a private Docker registry on the
+server. It is only bound to 127.0.0.1, so pusher reaches it through
+an SSH tunnel.
+*/
+var SetupServiceRegistryCommand = sshutils.Step{
+	Commands: []sshutils.Command{
+		sshutils.NewCommand(
+			`cd ~ && mkdir -p services/registry/data`,
+			"Installing Docker registry...",
+		),
+		sshutils.NewCommand(
+			`cd ~/services/registry && tee docker-compose.yml <<EOF
+services:
+  registry:
+    image: registry:`+RegistryVersion+`
+    container_name: registry
+    restart: unless-stopped
+    ports:
+      - 127.0.0.1:5000:5000
+    volumes:
+      - ~/services/registry/data:/var/lib/registry
+EOF`,
+			"Installing Docker registry...",
+		),
+		sshutils.NewCommand(
+			`cd services/registry && sudo docker compose up -d`,
+			"Starting Docker registry...",
+		).WithRetry(sshutils.NetworkRetry).WithTimeout(10 * time.Minute),
+	},
+	StartingMessage: "Setting up Docker registry...",
+	SuccessMessage:  "Docker registry setup successfully.",
+	ErrorMessage:    "There was a problem setting up the Docker registry: %s",
+}
@@ -21,7 +21,11 @@ THE SOFTWARE.
 */
 package commands
 
-import "github.com/adampresley/pusher/pkg/sshutils"
+import (
+	"time"
+
+	"github.com/adampresley/pusher/pkg/sshutils"
+)
 
 var SetupTraefikCommand = sshutils.Step{
 	Commands: []sshutils.Command{
@@ -90,6 +94,9 @@ certificatesResolvers:
       httpChallenge:
         entryPoint: web
 
+accessLog:
+  format: json
+
 providers:
   docker:
     exposedByDefault: false
@@ -99,7 +106,7 @@ EOF`,
 		sshutils.NewCommand(
 			`cd traefik && sudo docker compose up -d`,
 			"Starting Traefik...",
-		),
+		).WithRetry(sshutils.NetworkRetry).WithTimeout(10 * time.Minute),
 	},
 	StartingMessage: "Setting up Traefik...",
 	SuccessMessage:  "Traefik setup successfully.",
@@ -26,7 +26,7 @@ import "github.com/adampresley/pusher/pkg/sshutils"
 var StartApplicationCommand = sshutils.Step{
 	Commands: []sshutils.Command{
 		sshutils.NewCommand(
-			`cd applications/{{.ServiceName}} && sudo docker compose up -d`,
+			`cd applications/{{.ServiceName}} && sudo docker compose {{if .Color}}-p {{.ServiceName}}-{{.Color}} -f docker-compose.{{.Color}}.yml {{end}}up -d`,
 			"Starting application...",
 		),
 	},
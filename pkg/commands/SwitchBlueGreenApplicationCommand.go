@@ -0,0 +1,46 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package commands
+
+import "github.com/adampresley/pusher/pkg/sshutils"
+
+/*
+SwitchBlueGreenApplicationCommand records the newly started colour as
+the active one and stops the previously active container. Run it only
+once RouteBlueGreenApplicationCommand has moved traffic to the new
+colour, so the old container is no longer serving when it goes away.
+*/
+var SwitchBlueGreenApplicationCommand = sshutils.Step{
+	Commands: []sshutils.Command{
+		sshutils.NewCommand(
+			`cd ~/applications/{{.ServiceName}} && echo {{.Color}} > .active-color`,
+			"Recording the active container...",
+		),
+		sshutils.NewCommand(
+			`cd ~/applications/{{.ServiceName}} && {{if .PreviousColor}}sudo docker compose -p {{.ServiceName}}-{{.PreviousColor}} -f docker-compose.{{.PreviousColor}}.yml down{{else}}if [ -f docker-compose.yml ]; then sudo docker compose -f docker-compose.yml down; fi{{end}}`,
+			"Stopping previous container...",
+		),
+	},
+	StartingMessage: "Switching to new container...",
+	SuccessMessage:  "Traffic switched to new container.",
+	ErrorMessage:    "There was a problem switching to the new container: %s",
+}
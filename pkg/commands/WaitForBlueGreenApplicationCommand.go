@@ -0,0 +1,58 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package commands
+
+import "github.com/adampresley/pusher/pkg/sshutils"
+
+/*
+waitForColorScript waits for the colour's container to be healthy, or
+to keep running when the image has no HEALTHCHECK.
+*/
+const waitForColorScript = `running=0; for i in $(seq 1 60); do
+  state=$(docker inspect -f '{{"{{if .State.Health}}{{.State.Health.Status}}{{else}}{{.State.Status}}{{end}}"}}' {{.ServiceName}}-{{.Color}} 2>/dev/null)
+  case "$state" in
+    healthy) exit 0 ;;
+    running) running=$((running+1)); [ $running -ge 5 ] && exit 0 ;;
+    starting) ;;
+    *) echo "container state: $state"; exit 1 ;;
+  esac
+  sleep 2
+done
+echo "timed out waiting for {{.ServiceName}}-{{.Color}} to become healthy"; exit 1`
+
+/*
+WaitForBlueGreenApplicationCommand waits for the newly started colour
+to become healthy. Containers without a Docker HEALTHCHECK are
+considered healthy once they have stayed running for several
+consecutive checks.
+*/
+var WaitForBlueGreenApplicationCommand = sshutils.Step{
+	Commands: []sshutils.Command{
+		sshutils.NewCommand(
+			waitForColorScript,
+			"Waiting for new container to become healthy...",
+		),
+	},
+	StartingMessage: "Waiting for new container...",
+	SuccessMessage:  "New container is healthy.",
+	ErrorMessage:    "The new container did not become healthy: %s",
+}
@@ -30,17 +30,28 @@ import (
 )
 
 type ContextInfo struct {
-	Dependencies []string
-	Domain       string
-	Email        string
-	Env          map[string]string
-	EnvFile      string
-	HostName     string
-	IdentityFile string
-	Mounts       []string
-	Port         string
-	ServiceName  string
-	User         string
+	Color            string
+	Dependencies     []string
+	DockerBuild      DockerBuildInfo
+	Domain           string
+	DryRun           bool
+	Email            string
+	Env              map[string]string
+	EnvFile          string
+	HealthCheck      HealthCheckInfo
+	HostName         string
+	IdentityFile     string
+	ImageTag         string
+	KeepImages       int
+	Live             bool
+	MountDirectories []string
+	Mounts           []string
+	Port             string
+	PreviousColor    string
+	Priority         string
+	Registry         string
+	ServiceName      string
+	User             string
 }
 
 func (c ContextInfo) ExpandCommand(command string) string {
@@ -75,3 +86,34 @@ func (c ContextInfo) ExpandCommand(command string) string {
 
 	return result.String()
 }
+
+/*
+Quote makes a value safe to use as a single shell word in a command template.
+*/
+func (c ContextInfo) Quote(value string) string {
+	return ShellQuote(value)
+}
+
+/*
+QuotePath quotes a path on the server for the shell. The shell doesn't
+expand a quoted ~, so a leading one is replaced with $HOME.
+*/
+func (c ContextInfo) QuotePath(path string) string {
+	if path == "~" {
+		return `"$HOME"`
+	}
+
+	if rest, found := strings.CutPrefix(path, "~/"); found {
+		return `"$HOME"/` + ShellQuote(rest)
+	}
+
+	return ShellQuote(path)
+}
+
+/*
+ShellQuote wraps a value in single quotes for the shell, escaping any
+single quotes inside it.
+*/
+func ShellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
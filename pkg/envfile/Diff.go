@@ -0,0 +1,69 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package envfile
+
+import "sort"
+
+const (
+	ChangeAdded   string = "+"
+	ChangeRemoved string = "-"
+	ChangeUpdated string = "~"
+)
+
+type Change struct {
+	Kind     string
+	Key      string
+	OldValue string
+	NewValue string
+}
+
+/*
+Diff returns the keys that were added, removed, or changed going
+from one env file to another, sorted by key.
+*/
+func Diff(from, to *EnvFile) []Change {
+	result := []Change{}
+	fromValues := from.Map()
+	toValues := to.Map()
+
+	for key, newValue := range toValues {
+		oldValue, found := fromValues[key]
+
+		if !found {
+			result = append(result, Change{Kind: ChangeAdded, Key: key, NewValue: newValue})
+		} else if oldValue != newValue {
+			result = append(result, Change{Kind: ChangeUpdated, Key: key, OldValue: oldValue, NewValue: newValue})
+		}
+	}
+
+	for key, oldValue := range fromValues {
+		if _, found := toValues[key]; !found {
+			result = append(result, Change{Kind: ChangeRemoved, Key: key, OldValue: oldValue})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+
+	return result
+}
@@ -0,0 +1,223 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package envfile
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+/*
+Variable is a single KEY=value pair from an env file. Line is the
+1-based line number it was read from.
+*/
+type Variable struct {
+	Key   string
+	Value string
+	Line  int
+}
+
+/*
+EnvFile is a parsed env file. Comments, blank lines, and the order of
+variables are kept so the file can be edited and written back.
+*/
+type EnvFile struct {
+	lines []string
+}
+
+/*
+Parse reads an env file in the format used by Docker compose's env_file.
+*/
+func Parse(reader io.Reader) (*EnvFile, error) {
+	result := &EnvFile{}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		result.lines = append(result.lines, scanner.Text())
+	}
+
+	return result, scanner.Err()
+}
+
+/*
+ParseString is Parse for an env file already in memory.
+*/
+func ParseString(contents string) (*EnvFile, error) {
+	return Parse(strings.NewReader(contents))
+}
+
+/*
+Variables returns every variable in the file, in order. A key that
+appears more than once is returned each time.
+*/
+func (e *EnvFile) Variables() []Variable {
+	result := []Variable{}
+
+	for index, line := range e.lines {
+		if key, value, ok := parseLine(line); ok {
+			result = append(result, Variable{
+				Key:   key,
+				Value: value,
+				Line:  index + 1,
+			})
+		}
+	}
+
+	return result
+}
+
+/*
+Map returns the variables as a map. When a key appears more than once
+the last value wins, as it does in Docker.
+*/
+func (e *EnvFile) Map() map[string]string {
+	result := map[string]string{}
+
+	for _, v := range e.Variables() {
+		result[v.Key] = v.Value
+	}
+
+	return result
+}
+
+func (e *EnvFile) Get(key string) (string, bool) {
+	value, ok := e.Map()[key]
+	return value, ok
+}
+
+/*
+Set changes the value of a key in place, or adds it to the end of
+the file when it isn't there yet.
+*/
+func (e *EnvFile) Set(key, value string) {
+	line := key + "=" + quoteValue(value)
+
+	for index, l := range e.lines {
+		if k, _, ok := parseLine(l); ok && k == key {
+			e.lines[index] = line
+			return
+		}
+	}
+
+	e.lines = append(e.lines, line)
+}
+
+/*
+Unset removes every line that sets key, and returns false when there
+were none.
+*/
+func (e *EnvFile) Unset(key string) bool {
+	found := false
+	lines := []string{}
+
+	for _, l := range e.lines {
+		if k, _, ok := parseLine(l); ok && k == key {
+			found = true
+			continue
+		}
+
+		lines = append(lines, l)
+	}
+
+	e.lines = lines
+	return found
+}
+
+func (e *EnvFile) String() string {
+	if len(e.lines) == 0 {
+		return ""
+	}
+
+	return strings.Join(e.lines, "\n") + "\n"
+}
+
+func parseLine(line string) (string, string, bool) {
+	line = strings.TrimSpace(line)
+
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", false
+	}
+
+	line = strings.TrimPrefix(line, "export ")
+	key, value, found := strings.Cut(line, "=")
+
+	if !found {
+		return strings.TrimSpace(key), "", true
+	}
+
+	return strings.TrimSpace(key), unquoteValue(strings.TrimSpace(value)), true
+}
+
+/*
+unquoteValue reads a value the way compose does. Quoted values end at
+the closing quote, and an escaped quote inside them is kept. Unquoted
+values end at an inline comment.
+*/
+func unquoteValue(value string) string {
+	if value == "" {
+		return value
+	}
+
+	quote := value[0]
+
+	if quote != '"' && quote != '\'' {
+		if index := strings.Index(value, " #"); index >= 0 {
+			return strings.TrimSpace(value[:index])
+		}
+
+		return value
+	}
+
+	result := strings.Builder{}
+
+	for i := 1; i < len(value); i++ {
+		c := value[i]
+
+		if c == '\\' && i+1 < len(value) && (value[i+1] == quote || (quote == '"' && value[i+1] == '\\')) {
+			result.WriteByte(value[i+1])
+			i++
+			continue
+		}
+
+		if c == quote {
+			return result.String()
+		}
+
+		result.WriteByte(c)
+	}
+
+	return value
+}
+
+/*
+quoteValue single quotes values that compose would otherwise split,
+treat as a comment, or interpolate, such as secrets containing '$'.
+*/
+func quoteValue(value string) string {
+	if strings.ContainsAny(value, " \t#\"'$") {
+		return "'" + strings.ReplaceAll(value, "'", `\'`) + "'"
+	}
+
+	return value
+}
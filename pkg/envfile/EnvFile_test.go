@@ -0,0 +1,114 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package envfile_test
+
+import (
+	"testing"
+
+	"github.com/adampresley/pusher/pkg/envfile"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvFile(t *testing.T) {
+	contents := "# database\nDB_HOST=localhost\nexport DB_PASSWORD=\"s3cret value\"\n\nDEBUG='true'\n"
+
+	t.Run("parses variables and keeps their order", func(t *testing.T) {
+		file, err := envfile.ParseString(contents)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []envfile.Variable{
+			{Key: "DB_HOST", Value: "localhost", Line: 2},
+			{Key: "DB_PASSWORD", Value: "s3cret value", Line: 3},
+			{Key: "DEBUG", Value: "true", Line: 5},
+		}, file.Variables())
+	})
+
+	t.Run("set replaces in place and appends new keys", func(t *testing.T) {
+		file, _ := envfile.ParseString(contents)
+
+		file.Set("DB_HOST", "db.internal")
+		file.Set("PORT", "8080")
+
+		assert.Equal(t, "# database\nDB_HOST=db.internal\nexport DB_PASSWORD=\"s3cret value\"\n\nDEBUG='true'\nPORT=8080\n", file.String())
+	})
+
+	t.Run("unset removes the key", func(t *testing.T) {
+		file, _ := envfile.ParseString(contents)
+
+		assert.True(t, file.Unset("DEBUG"))
+		assert.False(t, file.Unset("MISSING"))
+
+		_, found := file.Get("DEBUG")
+		assert.False(t, found)
+	})
+
+	t.Run("diff reports added, removed, and changed keys", func(t *testing.T) {
+		from, _ := envfile.ParseString("A=1\nB=2\nC=3\n")
+		to, _ := envfile.ParseString("A=1\nB=20\nD=4\n")
+
+		assert.Equal(t, []envfile.Change{
+			{Kind: envfile.ChangeUpdated, Key: "B", OldValue: "2", NewValue: "20"},
+			{Kind: envfile.ChangeRemoved, Key: "C", OldValue: "3"},
+			{Kind: envfile.ChangeAdded, Key: "D", NewValue: "4"},
+		}, envfile.Diff(from, to))
+	})
+
+	t.Run("masks secret values", func(t *testing.T) {
+		assert.Equal(t, "********", envfile.Mask("DB_PASSWORD", "hunter2"))
+		assert.Equal(t, "localhost", envfile.Mask("DB_HOST", "localhost"))
+	})
+}
+
+func TestEnvFileQuoting(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		line  string
+	}{
+		{name: "plain", value: "localhost", line: "KEY=localhost"},
+		{name: "double quote", value: `say "hi"`, line: `KEY='say "hi"'`},
+		{name: "single quote", value: "it's", line: `KEY='it\'s'`},
+		{name: "dollar", value: "pa$$word", line: "KEY='pa$$word'"},
+		{name: "hash", value: "a#b", line: "KEY='a#b'"},
+		{name: "everything", value: `'"$# mixed`, line: `KEY='\'"$# mixed'`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, _ := envfile.ParseString("")
+			file.Set("KEY", tt.value)
+			assert.Equal(t, tt.line+"\n", file.String())
+
+			parsed, err := envfile.ParseString(file.String())
+			assert.NoError(t, err)
+
+			got, _ := parsed.Get("KEY")
+			assert.Equal(t, tt.value, got)
+		})
+	}
+
+	t.Run("reads escapes and inline comments", func(t *testing.T) {
+		file, _ := envfile.ParseString("A=\"say \\\"hi\\\"\"\nB='x' # comment\nC=plain # comment\n")
+
+		assert.Equal(t, map[string]string{"A": `say "hi"`, "B": "x", "C": "plain"}, file.Map())
+	})
+}
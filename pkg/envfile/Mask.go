@@ -0,0 +1,63 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package envfile
+
+import "strings"
+
+var secretKeyParts = []string{
+	"AUTH",
+	"CREDENTIAL",
+	"DSN",
+	"KEY",
+	"PASS",
+	"PRIVATE",
+	"SECRET",
+	"TOKEN",
+	"DATABASE_URL",
+}
+
+/*
+IsSecret returns true when a key's name suggests its value is sensitive,
+such as API_KEY or DB_PASSWORD.
+*/
+func IsSecret(key string) bool {
+	upper := strings.ToUpper(key)
+
+	for _, part := range secretKeyParts {
+		if strings.Contains(upper, part) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+Mask hides the value of a secret key. Other values are returned as is.
+*/
+func Mask(key, value string) string {
+	if !IsSecret(key) || value == "" {
+		return value
+	}
+
+	return "********"
+}
@@ -0,0 +1,167 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package local
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
+)
+
+/*
+WriteBuildContext writes a gzipped tar of a Docker build context to w,
+leaving out anything matched by the context's .dockerignore file. As
+with `docker build`, the Dockerfile and .dockerignore are always sent.
+dockerfile is relative to the context, and may be empty for "Dockerfile".
+*/
+func WriteBuildContext(w io.Writer, contextDir, dockerfile string) error {
+	var (
+		err      error
+		patterns []string
+		matcher  *patternmatcher.PatternMatcher
+	)
+
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+
+	dockerfile = filepath.ToSlash(filepath.Clean(dockerfile))
+
+	if patterns, err = readDockerIgnore(contextDir); err != nil {
+		return err
+	}
+
+	if matcher, err = patternmatcher.New(patterns); err != nil {
+		return fmt.Errorf("There was a problem reading .dockerignore: %s", err.Error())
+	}
+
+	compressor := gzip.NewWriter(w)
+	writer := tar.NewWriter(compressor)
+
+	err = filepath.WalkDir(contextDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relative, _ := filepath.Rel(contextDir, path)
+
+		if relative == "." {
+			return nil
+		}
+
+		relative = filepath.ToSlash(relative)
+
+		if relative != dockerfile && relative != ".dockerignore" {
+			ignored, err := matcher.MatchesOrParentMatches(relative)
+
+			if err != nil {
+				return err
+			}
+
+			if ignored {
+				if d.IsDir() && !matcher.Exclusions() {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+		}
+
+		return addToTar(writer, path, relative, d)
+	})
+
+	if err != nil {
+		return fmt.Errorf("There was a problem packaging the build context '%s': %s", contextDir, err.Error())
+	}
+
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	return compressor.Close()
+}
+
+func readDockerIgnore(contextDir string) ([]string, error) {
+	f, err := os.Open(filepath.Join(contextDir, ".dockerignore"))
+
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("There was a problem opening .dockerignore: %s", err.Error())
+	}
+
+	defer f.Close()
+	return ignorefile.ReadAll(f)
+}
+
+func addToTar(writer *tar.Writer, path, name string, d fs.DirEntry) error {
+	var (
+		err    error
+		info   fs.FileInfo
+		link   string
+		header *tar.Header
+	)
+
+	if info, err = d.Info(); err != nil {
+		return err
+	}
+
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	}
+
+	if header, err = tar.FileInfoHeader(info, link); err != nil {
+		return err
+	}
+
+	header.Name = name
+
+	if err = writer.WriteHeader(header); err != nil {
+		return err
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	f, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	_, err = io.Copy(writer, f)
+	return err
+}
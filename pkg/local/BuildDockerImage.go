@@ -1,6 +1,5 @@
 package local
 
 var BuildDockerImageCommand = `
-	docker build --cache-from={{.ServiceName}}:latest --tag {{.ServiceName}}:latest --platform linux/amd64 . && \
-	docker save -o {{.ServiceName}}-latest.tar {{.ServiceName}}
+	{{if .Secrets}}DOCKER_BUILDKIT=1 {{end}}docker build --cache-from={{.ServiceName}}:latest --tag {{.ServiceName}}:latest --tag {{.ServiceName}}:{{.ImageTag}} --platform {{.Platform}}{{if .Dockerfile}} --file {{.Quote .Dockerfile}}{{end}}{{if .Target}} --target {{.Quote .Target}}{{end}}{{range .BuildArgs}} --build-arg {{$.Quote .}}{{end}}{{range .Secrets}} --secret {{$.Quote .}}{{end}} {{.Quote .Context}}
 `
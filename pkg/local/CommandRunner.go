@@ -11,6 +11,13 @@ import (
 
 func RunLocalCommand(cmd LocalCommand) {
 	commandText := cmd.Parse()
+
+	if cmd.DryRun {
+		rendering.Print("# Local: %s", cmd.CommandDescription)
+		rendering.Print("%s", strings.TrimSpace(commandText))
+		rendering.BlankLine()
+		return
+	}
 	// cwd, _ := os.Getwd()
 
 	spinner := rendering.Spinner(fmt.Sprintf("Running: %s...", cmd.CommandDescription))
@@ -18,6 +25,7 @@ func RunLocalCommand(cmd LocalCommand) {
 	// commandRunner := exec.Command("sh", "-s", "-", cwd, cmd.SerivceName, cmd.Host)
 	commandRunner := exec.Command("sh", "-s")
 	commandRunner.Stdin = strings.NewReader(commandText)
+	commandRunner.Env = append(os.Environ(), cmd.Env...)
 
 	if cmd.Debug {
 		rendering.Print("Running local command: %s", commandText)
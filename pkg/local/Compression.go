@@ -0,0 +1,75 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package local
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	CompressionNone string = ""
+	CompressionOff  string = "none"
+	CompressionGzip string = "gzip"
+	CompressionZstd string = "zstd"
+)
+
+/*
+IsCompressed returns true when compression, as set in pusher.yaml, asks
+for the image to be streamed compressed. Leaving it out and "none" both
+mean it isn't.
+*/
+func IsCompressed(compression string) bool {
+	return compression != CompressionNone && compression != CompressionOff
+}
+
+/*
+NewCompressor wraps a writer with the requested compression. Closing
+the result flushes it, but does not close the underlying writer.
+*/
+func NewCompressor(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+
+	default:
+		return nil, fmt.Errorf("Unknown compression '%s'. Use '%s' or '%s'", compression, CompressionGzip, CompressionZstd)
+	}
+}
+
+/*
+DecompressCommand returns the shell command that decompresses a
+stream created by NewCompressor.
+*/
+func DecompressCommand(compression string) string {
+	if compression == CompressionZstd {
+		return "zstd -d -c"
+	}
+
+	return "gunzip -c"
+}
@@ -0,0 +1,221 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package local
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+/*
+ImageLayersListFileName is written into a reduced image archive. Each line
+has the path and digest of a layer that was left out because the server
+already has it.
+*/
+const ImageLayersListFileName string = "pusher-layers.txt"
+
+type imageManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+/*
+ReduceImageArchive rewrites an archive created by `docker save`, leaving
+out every layer whose digest is in remoteLayers. The layers left out are
+listed in ImageLayersListFileName so the server can put them back from
+its own copy before running `docker load`. It returns how many bytes
+were left out.
+*/
+func ReduceImageArchive(archivePath string, remoteLayers []string) (int64, error) {
+	var (
+		err      error
+		digests  map[string]string
+		in       *os.File
+		out      *os.File
+		skipped  int64
+		listing  strings.Builder
+		tempPath = archivePath + ".reduced"
+	)
+
+	remote := map[string]struct{}{}
+
+	for _, l := range remoteLayers {
+		remote[strings.TrimPrefix(l, "sha256:")] = struct{}{}
+	}
+
+	if digests, err = layerDigests(archivePath); err != nil {
+		return 0, err
+	}
+
+	omit := map[string]struct{}{}
+
+	for layerPath, digest := range digests {
+		if _, found := remote[digest]; found {
+			omit[layerPath] = struct{}{}
+			listing.WriteString(layerPath + " " + digest + "\n")
+		}
+	}
+
+	if len(omit) == 0 {
+		return 0, nil
+	}
+
+	if in, err = os.Open(archivePath); err != nil {
+		return 0, fmt.Errorf("There was a problem opening image archive '%s': %s", archivePath, err.Error())
+	}
+
+	defer in.Close()
+
+	if out, err = os.Create(tempPath); err != nil {
+		return 0, fmt.Errorf("There was a problem creating reduced image archive '%s': %s", tempPath, err.Error())
+	}
+
+	defer out.Close()
+
+	reader := tar.NewReader(in)
+	writer := tar.NewWriter(out)
+
+	for {
+		header, err := reader.Next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return 0, fmt.Errorf("There was a problem reading image archive '%s': %s", archivePath, err.Error())
+		}
+
+		if _, found := omit[path.Clean(header.Name)]; found && header.Typeflag == tar.TypeReg {
+			skipped += header.Size
+			continue
+		}
+
+		if err = writer.WriteHeader(header); err != nil {
+			return 0, fmt.Errorf("There was a problem writing reduced image archive: %s", err.Error())
+		}
+
+		if _, err = io.Copy(writer, reader); err != nil {
+			return 0, fmt.Errorf("There was a problem writing reduced image archive: %s", err.Error())
+		}
+	}
+
+	list := []byte(listing.String())
+
+	if err = writer.WriteHeader(&tar.Header{Name: ImageLayersListFileName, Mode: 0644, Size: int64(len(list))}); err != nil {
+		return 0, fmt.Errorf("There was a problem writing reduced image archive: %s", err.Error())
+	}
+
+	if _, err = writer.Write(list); err != nil {
+		return 0, fmt.Errorf("There was a problem writing reduced image archive: %s", err.Error())
+	}
+
+	if err = writer.Close(); err != nil {
+		return 0, fmt.Errorf("There was a problem writing reduced image archive: %s", err.Error())
+	}
+
+	if err = out.Close(); err != nil {
+		return 0, fmt.Errorf("There was a problem writing reduced image archive: %s", err.Error())
+	}
+
+	if err = os.Rename(tempPath, archivePath); err != nil {
+		return 0, fmt.Errorf("There was a problem replacing image archive '%s': %s", archivePath, err.Error())
+	}
+
+	return skipped, nil
+}
+
+/*
+layerDigests returns the sha256 digest of every layer listed in the
+archive's manifest, keyed by the layer's path in the archive. For
+`docker save` archives this digest is the layer's diff ID.
+*/
+func layerDigests(archivePath string) (map[string]string, error) {
+	var (
+		err       error
+		f         *os.File
+		manifests []imageManifest
+	)
+
+	if f, err = os.Open(archivePath); err != nil {
+		return nil, fmt.Errorf("There was a problem opening image archive '%s': %s", archivePath, err.Error())
+	}
+
+	defer f.Close()
+
+	hashes := map[string]string{}
+	reader := tar.NewReader(f)
+
+	for {
+		header, err := reader.Next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("There was a problem reading image archive '%s': %s", archivePath, err.Error())
+		}
+
+		name := path.Clean(header.Name)
+
+		if name == "manifest.json" {
+			if err = json.NewDecoder(reader).Decode(&manifests); err != nil {
+				return nil, fmt.Errorf("There was a problem reading the manifest in '%s': %s", archivePath, err.Error())
+			}
+
+			continue
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		hash := sha256.New()
+
+		if _, err = io.Copy(hash, reader); err != nil {
+			return nil, fmt.Errorf("There was a problem reading image archive '%s': %s", archivePath, err.Error())
+		}
+
+		hashes[name] = hex.EncodeToString(hash.Sum(nil))
+	}
+
+	result := map[string]string{}
+
+	for _, m := range manifests {
+		for _, l := range m.Layers {
+			if digest, found := hashes[path.Clean(l)]; found {
+				result[path.Clean(l)] = digest
+			}
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,119 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package local_test
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adampresley/pusher/pkg/local"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReduceImageArchive(t *testing.T) {
+	base := []byte("base layer contents")
+	app := []byte("app layer contents")
+
+	files := map[string][]byte{
+		"manifest.json":          []byte(`[{"Config":"config.json","RepoTags":["app:latest"],"Layers":["base/layer.tar","app/layer.tar"]}]`),
+		"config.json":            []byte(`{}`),
+		"base/layer.tar":         base,
+		"app/layer.tar":          app,
+		"repositories":           []byte(`{}`),
+		"blobs/sha256/something": []byte("unrelated"),
+	}
+
+	t.Run("leaves out layers the server already has", func(t *testing.T) {
+		archive := writeArchive(t, files)
+
+		skipped, err := local.ReduceImageArchive(archive, []string{"sha256:" + digest(base)})
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(base)), skipped)
+
+		got := readArchive(t, archive)
+		assert.NotContains(t, got, "base/layer.tar")
+		assert.Equal(t, app, got["app/layer.tar"])
+		assert.Equal(t, "base/layer.tar "+digest(base)+"\n", string(got[local.ImageLayersListFileName]))
+	})
+
+	t.Run("does not change the archive when the server has no layers", func(t *testing.T) {
+		archive := writeArchive(t, files)
+
+		skipped, err := local.ReduceImageArchive(archive, []string{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), skipped)
+		assert.Equal(t, files, readArchive(t, archive))
+	})
+}
+
+func digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func writeArchive(t *testing.T, files map[string][]byte) string {
+	name := filepath.Join(t.TempDir(), "image.tar")
+	f, err := os.Create(name)
+	assert.NoError(t, err)
+
+	defer f.Close()
+	writer := tar.NewWriter(f)
+
+	for n, b := range files {
+		assert.NoError(t, writer.WriteHeader(&tar.Header{Name: n, Mode: 0644, Size: int64(len(b)), Typeflag: tar.TypeReg}))
+		_, err = writer.Write(b)
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, writer.Close())
+	return name
+}
+
+func readArchive(t *testing.T, name string) map[string][]byte {
+	f, err := os.Open(name)
+	assert.NoError(t, err)
+
+	defer f.Close()
+	result := map[string][]byte{}
+	reader := tar.NewReader(f)
+
+	for {
+		header, err := reader.Next()
+
+		if err == io.EOF {
+			break
+		}
+
+		assert.NoError(t, err)
+		b, _ := io.ReadAll(reader)
+		result[header.Name] = b
+	}
+
+	return result
+}
@@ -5,15 +5,50 @@ import (
 	"strings"
 	"text/template"
 
+	"github.com/adampresley/pusher/pkg/contextinfo"
 	"github.com/adampresley/pusher/pkg/rendering"
 )
 
+/*
+Environment is extra environment for a local command, as NAME=value.
+Only the names are printed, as the values may be secrets.
+*/
+type Environment []string
+
+func (e Environment) String() string {
+	names := []string{}
+
+	for _, variable := range e {
+		name, _, _ := strings.Cut(variable, "=")
+		names = append(names, name)
+	}
+
+	return "[" + strings.Join(names, " ") + "]"
+}
+
 type LocalCommand struct {
 	Command            string
 	CommandDescription string
 	Debug              bool
+	DryRun             bool
 	ServiceName        string
 	Host               string
+	ImageTag           string
+	Registry           string
+	Dockerfile         string
+	Context            string
+	Target             string
+	BuildArgs          []string
+	Secrets            []string
+	Platform           string
+	Env                Environment
+}
+
+/*
+Quote makes a value safe to use as a single shell word in a command template.
+*/
+func (l LocalCommand) Quote(value string) string {
+	return contextinfo.ShellQuote(value)
 }
 
 func (l LocalCommand) Parse() string {
@@ -0,0 +1,43 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package local_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/adampresley/pusher/pkg/local"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalCommandHidesEnvValues(t *testing.T) {
+	cmd := local.LocalCommand{
+		Command:   local.BuildDockerImageCommand,
+		BuildArgs: []string{"API_TOKEN"},
+		Env:       local.Environment{"API_TOKEN=s3cr3t-value"},
+		Context:   ".",
+	}
+
+	assert.NotContains(t, cmd.Parse(), "s3cr3t-value")
+	assert.NotContains(t, fmt.Sprintf("%+v", cmd), "s3cr3t-value")
+	assert.Contains(t, fmt.Sprintf("%+v", cmd), "Env:[API_TOKEN]")
+}
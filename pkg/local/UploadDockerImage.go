@@ -1,5 +0,0 @@
-package local
-
-var UploadDockerImageCommand = `
-   scp {{.ServiceName}}-latest.tar {{.Host}}:~/applications/{{.ServiceName}} && rm {{.ServiceName}}-latest.tar
-`
@@ -0,0 +1,454 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package parsing
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultSSHPort int = 22
+
+	maxIncludeDepth int = 16
+)
+
+/*
+SSHHost is the configuration OpenSSH would use to connect to Alias.
+*/
+type SSHHost struct {
+	Alias         string
+	HostName      string
+	User          string
+	Port          int
+	IdentityFiles []string
+
+	// ProxyJump lists the jump hosts to connect through, in order,
+	// each as [user@]host[:port].
+	ProxyJump []string
+
+	// options holds the first value of every other keyword, keyed by
+	// its lower case name.
+	options map[string]string
+}
+
+/*
+Option returns the value of a keyword that has no field of its own, such
+as StrictHostKeyChecking, or an empty string when it isn't set.
+*/
+func (h SSHHost) Option(keyword string) string {
+	return h.options[strings.ToLower(keyword)]
+}
+
+/*
+Address returns host:port for dialing.
+*/
+func (h SSHHost) Address() string {
+	return net.JoinHostPort(h.HostName, strconv.Itoa(h.Port))
+}
+
+/*
+SSHConfigResolver resolves hosts the way OpenSSH does:
+
+  - The first value found for a keyword wins, so specific Host blocks
+    go before general ones, and "Host *" at the end provides defaults.
+  - IdentityFile is the exception. Every matching one is kept.
+  - Host patterns may use * and ? wildcards and ! negation.
+  - Match blocks support all, host, originalhost, user, and localuser.
+    Match exec is never considered a match.
+  - Include reads other files, relative to ~/.ssh, and may use globs.
+  - %h, %n, %p, %r, %u, %d and %% are expanded in HostName and paths.
+*/
+type SSHConfigResolver struct {
+	HomeDir   string
+	LocalUser string
+}
+
+/*
+ResolveSSHHost resolves alias from the user's SSH config file.
+*/
+func ResolveSSHHost(alias string) (SSHHost, error) {
+	resolver := SSHConfigResolver{
+		HomeDir: os.Getenv("HOME"),
+	}
+
+	if u, err := user.Current(); err == nil {
+		resolver.LocalUser = u.Username
+	}
+
+	return resolver.Resolve(DefaultSSHConfigFile, alias)
+}
+
+type resolveState struct {
+	alias         string
+	values        map[string]string
+	identityFiles []string
+}
+
+/*
+Resolve reads fileName and returns the configuration for alias.
+*/
+func (r SSHConfigResolver) Resolve(fileName, alias string) (SSHHost, error) {
+	var (
+		err error
+	)
+
+	state := &resolveState{
+		alias:  alias,
+		values: map[string]string{},
+	}
+
+	if err = r.readFile(fileName, state, 0); err != nil {
+		return SSHHost{}, err
+	}
+
+	result := SSHHost{
+		Alias:    alias,
+		HostName: alias,
+		User:     r.LocalUser,
+		Port:     DefaultSSHPort,
+		options:  map[string]string{},
+	}
+
+	for key, value := range state.values {
+		switch key {
+		case "hostname":
+			result.HostName = r.expandTokens(value, result)
+
+		case "user":
+			result.User = value
+
+		case "port":
+			if result.Port, err = strconv.Atoi(value); err != nil {
+				return result, fmt.Errorf("Invalid Port '%s' in your SSH config for '%s'", value, alias)
+			}
+
+		case "proxyjump":
+			if !strings.EqualFold(value, "none") {
+				for _, jump := range strings.Split(value, ",") {
+					result.ProxyJump = append(result.ProxyJump, strings.TrimSpace(jump))
+				}
+			}
+
+		default:
+			result.options[key] = value
+		}
+	}
+
+	/*
+	 * Paths can refer to the final host name, port, and user, so they
+	 * are expanded last.
+	 */
+	for _, identityFile := range state.identityFiles {
+		result.IdentityFiles = append(result.IdentityFiles, r.expandPath(identityFile, result))
+	}
+
+	for _, key := range []string{"userknownhostsfile", "identityagent", "certificatefile"} {
+		if value, found := result.options[key]; found {
+			result.options[key] = r.expandPath(value, result)
+		}
+	}
+
+	return result, nil
+}
+
+func (r SSHConfigResolver) readFile(fileName string, state *resolveState, depth int) error {
+	var (
+		err error
+		f   *os.File
+	)
+
+	if f, err = os.Open(fileName); err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	active := true
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		keyword, args, err := splitSSHConfigLine(scanner.Text())
+
+		if err != nil {
+			return fmt.Errorf("%s: %s", fileName, err.Error())
+		}
+
+		if keyword == "" {
+			continue
+		}
+
+		switch keyword {
+		case "host":
+			active = matchPatternList(state.alias, args)
+
+		case "match":
+			if active, err = r.matchCriteria(args, state); err != nil {
+				return fmt.Errorf("%s: %s", fileName, err.Error())
+			}
+
+		case "include":
+			if !active {
+				continue
+			}
+
+			if depth >= maxIncludeDepth {
+				return fmt.Errorf("%s: Include nested too deeply", fileName)
+			}
+
+			for _, pattern := range args {
+				matches, _ := filepath.Glob(r.includePath(pattern))
+
+				for _, match := range matches {
+					if err = r.readFile(match, state, depth+1); err != nil {
+						return err
+					}
+				}
+			}
+
+		case "identityfile":
+			if active && len(args) > 0 && !containsString(state.identityFiles, args[0]) {
+				state.identityFiles = append(state.identityFiles, args[0])
+			}
+
+		default:
+			if _, found := state.values[keyword]; active && !found && len(args) > 0 {
+				state.values[keyword] = strings.Join(args, " ")
+			}
+		}
+	}
+
+	return scanner.Err()
+}
+
+/*
+matchCriteria evaluates the criteria of a Match line. Every criterion
+must match.
+*/
+func (r SSHConfigResolver) matchCriteria(args []string, state *resolveState) (bool, error) {
+	result := true
+
+	for i := 0; i < len(args); i++ {
+		criterion := strings.ToLower(args[i])
+		negate := strings.HasPrefix(criterion, "!")
+		criterion = strings.TrimPrefix(criterion, "!")
+
+		var matched bool
+
+		switch criterion {
+		case "all", "final":
+			matched = true
+
+		case "canonical":
+			matched = false
+
+		case "host", "originalhost", "user", "localuser", "exec":
+			if i+1 >= len(args) {
+				return false, fmt.Errorf("Match %s needs an argument", criterion)
+			}
+
+			i++
+			patterns := strings.Split(args[i], ",")
+
+			switch criterion {
+			case "host":
+				hostName := state.alias
+
+				if value, found := state.values["hostname"]; found {
+					hostName = strings.ReplaceAll(value, "%h", state.alias)
+				}
+
+				matched = matchPatternList(hostName, patterns)
+
+			case "originalhost":
+				matched = matchPatternList(state.alias, patterns)
+
+			case "user":
+				remoteUser := r.LocalUser
+
+				if value, found := state.values["user"]; found {
+					remoteUser = value
+				}
+
+				matched = matchPatternList(remoteUser, patterns)
+
+			case "localuser":
+				matched = matchPatternList(r.LocalUser, patterns)
+
+			case "exec":
+				matched = false
+			}
+
+		default:
+			return false, fmt.Errorf("Unsupported Match criterion '%s'", criterion)
+		}
+
+		if negate {
+			matched = !matched
+		}
+
+		result = result && matched
+	}
+
+	return result, nil
+}
+
+func (r SSHConfigResolver) includePath(pattern string) string {
+	pattern = r.expandHome(pattern)
+
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(r.HomeDir, ".ssh", pattern)
+	}
+
+	return pattern
+}
+
+func (r SSHConfigResolver) expandHome(value string) string {
+	if value == "~" {
+		return r.HomeDir
+	}
+
+	if strings.HasPrefix(value, "~/") {
+		return filepath.Join(r.HomeDir, value[2:])
+	}
+
+	return value
+}
+
+func (r SSHConfigResolver) expandPath(value string, host SSHHost) string {
+	return r.expandHome(r.expandTokens(value, host))
+}
+
+func (r SSHConfigResolver) expandTokens(value string, host SSHHost) string {
+	replacer := strings.NewReplacer(
+		"%%", "%",
+		"%d", r.HomeDir,
+		"%h", host.HostName,
+		"%n", host.Alias,
+		"%p", strconv.Itoa(host.Port),
+		"%r", host.User,
+		"%u", r.LocalUser,
+	)
+
+	return replacer.Replace(value)
+}
+
+/*
+splitSSHConfigLine splits a config line into its lower case keyword and
+arguments. Keywords may be separated from their arguments by spaces or
+an equals sign, and arguments may be wrapped in double quotes.
+*/
+func splitSSHConfigLine(line string) (string, []string, error) {
+	line = strings.TrimSpace(line)
+
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, nil
+	}
+
+	end := strings.IndexAny(line, " \t=")
+
+	if end == -1 {
+		return strings.ToLower(line), nil, nil
+	}
+
+	keyword := strings.ToLower(line[:end])
+	rest := strings.TrimSpace(line[end:])
+	rest = strings.TrimSpace(strings.TrimPrefix(rest, "="))
+
+	args := []string{}
+	current := strings.Builder{}
+	inQuotes := false
+	hasArg := false
+
+	for _, c := range rest {
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+			hasArg = true
+
+		case (c == ' ' || c == '\t') && !inQuotes:
+			if hasArg {
+				args = append(args, current.String())
+				current.Reset()
+				hasArg = false
+			}
+
+		case c == '#' && !inQuotes && !hasArg:
+			return keyword, args, nil
+
+		default:
+			current.WriteRune(c)
+			hasArg = true
+		}
+	}
+
+	if inQuotes {
+		return keyword, nil, fmt.Errorf("Unterminated quote in '%s'", line)
+	}
+
+	if hasArg {
+		args = append(args, current.String())
+	}
+
+	return keyword, args, nil
+}
+
+/*
+matchPatternList returns true when value matches at least one pattern
+and none of the negated ones.
+*/
+func matchPatternList(value string, patterns []string) bool {
+	result := false
+
+	for _, pattern := range patterns {
+		if negated, found := strings.CutPrefix(pattern, "!"); found {
+			if matched, _ := path.Match(negated, value); matched {
+				return false
+			}
+
+			continue
+		}
+
+		if matched, _ := path.Match(pattern, value); matched {
+			result = true
+		}
+	}
+
+	return result
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
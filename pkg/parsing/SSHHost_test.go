@@ -0,0 +1,233 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package parsing_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adampresley/pusher/pkg/parsing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSHConfigResolver(t *testing.T) {
+	type want struct {
+		hostName      string
+		user          string
+		port          int
+		identityFiles []string
+		proxyJump     []string
+		options       map[string]string
+	}
+
+	tests := []struct {
+		name   string
+		config string
+		files  map[string]string
+		alias  string
+		want   want
+	}{
+		{
+			name: "reads a simple host",
+			config: `Host testing
+   HostName 1.2.3.4
+   User bob
+   IdentityFile ~/.ssh/id_rsa`,
+			alias: "testing",
+			want:  want{hostName: "1.2.3.4", user: "bob", port: 22, identityFiles: []string{"{home}/.ssh/id_rsa"}},
+		},
+		{
+			name: "defaults to the alias and local user",
+			config: `Host other
+   HostName 5.6.7.8`,
+			alias: "testing",
+			want:  want{hostName: "testing", user: "me", port: 22},
+		},
+		{
+			name: "first value wins and Host * provides defaults",
+			config: `Host testing
+   Port 2222
+   User bob
+
+Host *
+   Port 22
+   User root
+   IdentityFile ~/.ssh/default`,
+			alias: "testing",
+			want:  want{hostName: "testing", user: "bob", port: 2222, identityFiles: []string{"{home}/.ssh/default"}},
+		},
+		{
+			name: "global options before any Host apply to every host",
+			config: `User global
+
+Host testing
+   User bob`,
+			alias: "testing",
+			want:  want{hostName: "testing", user: "global", port: 22},
+		},
+		{
+			name: "keeps every matching IdentityFile",
+			config: `Host testing
+   IdentityFile ~/.ssh/first
+
+Host *
+   IdentityFile ~/.ssh/second`,
+			alias: "testing",
+			want:  want{hostName: "testing", user: "me", port: 22, identityFiles: []string{"{home}/.ssh/first", "{home}/.ssh/second"}},
+		},
+		{
+			name: "supports wildcards and negation",
+			config: `Host *.internal !db.internal
+   User wildcard
+
+Host *
+   User fallback`,
+			alias: "db.internal",
+			want:  want{hostName: "db.internal", user: "fallback", port: 22},
+		},
+		{
+			name: "supports equals signs and quoted values",
+			config: `Host testing
+   Port=2200
+   IdentityFile "~/my keys/id_ed25519"`,
+			alias: "testing",
+			want:  want{hostName: "testing", user: "me", port: 2200, identityFiles: []string{"{home}/my keys/id_ed25519"}},
+		},
+		{
+			name: "expands tokens",
+			config: `Host testing
+   HostName %h.example.com
+   User deploy
+   IdentityFile ~/.ssh/%h-%r-%u
+   UserKnownHostsFile %d/.ssh/known_%n`,
+			alias: "testing",
+			want: want{
+				hostName:      "testing.example.com",
+				user:          "deploy",
+				port:          22,
+				identityFiles: []string{"{home}/.ssh/testing.example.com-deploy-me"},
+				options:       map[string]string{"UserKnownHostsFile": "{home}/.ssh/known_testing"},
+			},
+		},
+		{
+			name: "reads Include files relative to ~/.ssh",
+			config: `Include config.d/*
+
+Host *
+   User fallback`,
+			files: map[string]string{
+				"config.d/testing": "Host testing\n   HostName 1.2.3.4\n   User included\n",
+			},
+			alias: "testing",
+			want:  want{hostName: "1.2.3.4", user: "included", port: 22},
+		},
+		{
+			name: "Include inside a Host block only applies to that host",
+			config: `Host other
+   Include extra
+
+Host *
+   User fallback`,
+			files: map[string]string{
+				"extra": "User extra\n",
+			},
+			alias: "testing",
+			want:  want{hostName: "testing", user: "fallback", port: 22},
+		},
+		{
+			name: "Match host uses the HostName",
+			config: `Host testing
+   HostName server.example.com
+
+Match host *.example.com
+   User matched
+   Port 2022`,
+			alias: "testing",
+			want:  want{hostName: "server.example.com", user: "matched", port: 2022},
+		},
+		{
+			name: "Match originalhost and negation",
+			config: `Match originalhost testing !user root
+   Port 2023
+
+Match exec "true"
+   Port 2024`,
+			alias: "testing",
+			want:  want{hostName: "testing", user: "me", port: 2023},
+		},
+		{
+			name: "parses ProxyJump",
+			config: `Host testing
+   ProxyJump bastion,admin@jump2:2222`,
+			alias: "testing",
+			want:  want{hostName: "testing", user: "me", port: 22, proxyJump: []string{"bastion", "admin@jump2:2222"}},
+		},
+		{
+			name: "ProxyJump none turns jumping off",
+			config: `Host testing
+   ProxyJump none
+
+Host *
+   ProxyJump bastion`,
+			alias: "testing",
+			want:  want{hostName: "testing", user: "me", port: 22},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := t.TempDir()
+			configFile := filepath.Join(home, ".ssh", "config")
+
+			assert.NoError(t, os.MkdirAll(filepath.Join(home, ".ssh"), 0700))
+			assert.NoError(t, os.WriteFile(configFile, []byte(tt.config), 0600))
+
+			for name, contents := range tt.files {
+				fileName := filepath.Join(home, ".ssh", name)
+				assert.NoError(t, os.MkdirAll(filepath.Dir(fileName), 0700))
+				assert.NoError(t, os.WriteFile(fileName, []byte(contents), 0600))
+			}
+
+			resolver := parsing.SSHConfigResolver{HomeDir: home, LocalUser: "me"}
+			got, err := resolver.Resolve(configFile, tt.alias)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want.hostName, got.HostName)
+			assert.Equal(t, tt.want.user, got.User)
+			assert.Equal(t, tt.want.port, got.Port)
+			assert.Equal(t, tt.want.proxyJump, got.ProxyJump)
+
+			wantFiles := []string(nil)
+
+			for _, f := range tt.want.identityFiles {
+				wantFiles = append(wantFiles, filepath.Join(home, f[len("{home}"):]))
+			}
+
+			assert.Equal(t, wantFiles, got.IdentityFiles)
+
+			for key, value := range tt.want.options {
+				assert.Equal(t, filepath.Join(home, value[len("{home}"):]), got.Option(key))
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package project
+
+import (
+	"fmt"
+	"strconv"
+)
+
+/*
+Deployment records a single version of the application that
+was deployed to the server.
+*/
+type Deployment struct {
+	Version int
+	Date    string
+}
+
+type Deployments []Deployment
+
+func (d Deployment) String() string {
+	return fmt.Sprintf("%d (%s)", d.Version, d.Date)
+}
+
+func (d Deployment) Tag() string {
+	return strconv.Itoa(d.Version)
+}
+
+/*
+Latest returns at most the last count deployments.
+*/
+func (ds Deployments) Latest(count int) Deployments {
+	if len(ds) <= count {
+		return ds
+	}
+
+	return ds[len(ds)-count:]
+}
+
+/*
+Find returns the deployment for a specific version.
+*/
+func (ds Deployments) Find(version int) (Deployment, bool) {
+	for _, d := range ds {
+		if d.Version == version {
+			return d, true
+		}
+	}
+
+	return Deployment{}, false
+}
+
+func (ds Deployments) ToStrings() []string {
+	result := []string{}
+
+	for _, d := range ds {
+		result = append(result, d.String())
+	}
+
+	return result
+}
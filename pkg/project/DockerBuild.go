@@ -0,0 +1,162 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package project
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/adampresley/pusher/pkg/parsing"
+)
+
+/*
+DockerBuild holds options passed to `docker build`. Everything is
+optional. When Platform is empty it is detected from the server.
+*/
+type DockerBuild struct {
+	Dockerfile string            `yaml:",omitempty"`
+	Context    string            `yaml:",omitempty"`
+	Target     string            `yaml:",omitempty"`
+	Args       map[string]string `yaml:",omitempty"`
+	Secrets    []BuildSecret     `yaml:",omitempty"`
+	Platform   string            `yaml:",omitempty"`
+}
+
+/*
+BuildSecret is passed to `docker build --secret`. Set either Src, a
+local file, or Env, a local environment variable.
+*/
+type BuildSecret struct {
+	ID  string
+	Src string `yaml:",omitempty"`
+	Env string `yaml:",omitempty"`
+}
+
+func (d DockerBuild) GetContext() string {
+	if d.Context == "" {
+		return "."
+	}
+
+	return d.Context
+}
+
+/*
+BuildArgs returns each build arg as NAME=value, sorted by name. An empty
+value becomes a bare NAME, which Docker reads from the environment
+itself. So does a value starting with $, which BuildEnv puts in the
+environment, keeping it off the command line. With expand set, for
+builds that do not run locally, both are read from the local
+environment instead.
+*/
+func (d DockerBuild) BuildArgs(expand bool) []string {
+	result := []string{}
+
+	for _, name := range d.argNames() {
+		value := d.Args[name]
+
+		if !expand && (value == "" || strings.HasPrefix(value, "$")) {
+			result = append(result, name)
+			continue
+		}
+
+		if strings.HasPrefix(value, "$") {
+			value = os.ExpandEnv(value)
+		} else if value == "" {
+			value = os.Getenv(name)
+		}
+
+		result = append(result, name+"="+value)
+	}
+
+	return result
+}
+
+/*
+BuildEnv returns the build args read from the local environment as
+NAME=value, to set in the environment of a local `docker build`.
+*/
+func (d DockerBuild) BuildEnv() []string {
+	result := []string{}
+
+	for _, name := range d.argNames() {
+		if value := d.Args[name]; strings.HasPrefix(value, "$") {
+			result = append(result, name+"="+os.ExpandEnv(value))
+		}
+	}
+
+	return result
+}
+
+func (d DockerBuild) argNames() []string {
+	result := []string{}
+
+	for name := range d.Args {
+		result = append(result, name)
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+/*
+SecretSpecs returns each secret in the form used by `docker build --secret`.
+*/
+func (d DockerBuild) SecretSpecs() []string {
+	result := []string{}
+
+	for _, s := range d.Secrets {
+		spec := "id=" + s.ID
+
+		if s.Src != "" {
+			spec += ",src=" + parsing.ExpandHomeDir(s.Src)
+		}
+
+		if s.Env != "" {
+			spec += ",env=" + s.Env
+		}
+
+		result = append(result, spec)
+	}
+
+	return result
+}
+
+/*
+PlatformFromArch returns the Docker platform for a machine architecture
+as reported by `uname -m`.
+*/
+func PlatformFromArch(arch string) string {
+	switch strings.TrimSpace(arch) {
+	case "aarch64", "arm64":
+		return "linux/arm64"
+
+	case "armv7l", "armv7":
+		return "linux/arm/v7"
+
+	case "armv6l":
+		return "linux/arm/v6"
+
+	default:
+		return "linux/amd64"
+	}
+}
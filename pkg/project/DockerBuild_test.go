@@ -0,0 +1,55 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package project_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/adampresley/pusher/pkg/project"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDockerBuildArgs(t *testing.T) {
+	t.Setenv("PUSHER_TEST_TOKEN", "s3cr3t-value")
+	t.Setenv("NPM_TOKEN", "npm-value")
+
+	build := project.DockerBuild{
+		Args: map[string]string{
+			"NODE_ENV":  "production",
+			"API_TOKEN": "$PUSHER_TEST_TOKEN",
+			"NPM_TOKEN": "",
+		},
+	}
+
+	t.Run("local builds keep values from the environment off the command line", func(t *testing.T) {
+		args := build.BuildArgs(false)
+
+		assert.Equal(t, []string{"API_TOKEN", "NODE_ENV=production", "NPM_TOKEN"}, args)
+		assert.NotContains(t, strings.Join(args, " "), "s3cr3t-value")
+		assert.Equal(t, []string{"API_TOKEN=s3cr3t-value"}, build.BuildEnv())
+	})
+
+	t.Run("remote builds send the values", func(t *testing.T) {
+		assert.Equal(t, []string{"API_TOKEN=s3cr3t-value", "NODE_ENV=production", "NPM_TOKEN=npm-value"}, build.BuildArgs(true))
+	})
+}
@@ -0,0 +1,46 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package project
+
+const (
+	DefaultEnvExampleFile string = ".env.example"
+)
+
+/*
+EnvSchema describes what the env file must contain. Required lists keys
+that must be set to a value, and Patterns maps keys to regular
+expressions their whole values must match. When the Example file exists, the env file must set
+exactly the keys it does.
+*/
+type EnvSchema struct {
+	Required []string          `yaml:",omitempty"`
+	Patterns map[string]string `yaml:",omitempty"`
+	Example  string            `yaml:",omitempty"`
+}
+
+func (s EnvSchema) GetExample() string {
+	if s.Example == "" {
+		return DefaultEnvExampleFile
+	}
+
+	return s.Example
+}
@@ -0,0 +1,211 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package project
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+/*
+Environment is a named deploy target, such as staging or production.
+Any setting left empty is inherited from the top level of the project
+file. Versions and deploy dates are always tracked per environment.
+*/
+type Environment struct {
+	CertEmail   string `yaml:",omitempty"`
+	Domain      string `yaml:",omitempty"`
+	EnvFile     string `yaml:",omitempty"`
+	Host        string `yaml:",omitempty"`
+	Mounts      Mounts `yaml:",omitempty"`
+	Port        int    `yaml:",omitempty"`
+	ServiceName string `yaml:",omitempty"`
+
+	ActiveVersion  int         `yaml:",omitempty"`
+	History        Deployments `yaml:",omitempty"`
+	LastDeployDate string      `yaml:",omitempty"`
+	Version        int         `yaml:",omitempty"`
+}
+
+type Environments map[string]*Environment
+
+/*
+Names returns the environment names in sorted order.
+*/
+func (e Environments) Names() []string {
+	result := []string{}
+
+	for name := range e {
+		result = append(result, name)
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+/*
+SelectEnvironment makes the named environment's settings the project's
+settings. Saving the project afterwards writes environment specific
+values back to the environment and leaves shared settings at the top
+level. When create is true a missing environment is added.
+*/
+func (p *PusherProject) SelectEnvironment(name string, create bool) error {
+	if name == "" {
+		return nil
+	}
+
+	if p.Environments == nil {
+		p.Environments = Environments{}
+	}
+
+	env, ok := p.Environments[name]
+
+	if !ok {
+		if !create {
+			return fmt.Errorf("The environment '%s' was not found in '%s'. Available environments: %v", name, PusherProjectFileName, p.Environments.Names())
+		}
+
+		env = &Environment{}
+		p.Environments[name] = env
+	}
+
+	base := *p
+	p.base = &base
+	p.environmentName = name
+
+	if env.CertEmail != "" {
+		p.CertEmail = env.CertEmail
+	}
+
+	if env.Domain != "" {
+		p.Domain = env.Domain
+	}
+
+	if env.EnvFile != "" {
+		p.EnvFile = env.EnvFile
+	}
+
+	if env.Host != "" {
+		p.Host = env.Host
+	}
+
+	if len(env.Mounts) > 0 {
+		p.Mounts = env.Mounts
+	}
+
+	if env.Port != 0 {
+		p.Port = env.Port
+	}
+
+	if env.ServiceName != "" {
+		p.ServiceName = env.ServiceName
+	}
+
+	p.ActiveVersion = env.ActiveVersion
+	p.History = env.History
+	p.LastDeployDate = env.LastDeployDate
+	p.Version = env.Version
+
+	return nil
+}
+
+/*
+CurrentEnvironment returns the selected environment, or nil when
+the project is used without one.
+*/
+func (p *PusherProject) CurrentEnvironment() *Environment {
+	if p.environmentName == "" {
+		return nil
+	}
+
+	return p.Environments[p.environmentName]
+}
+
+func (p *PusherProject) EnvironmentName() string {
+	return p.environmentName
+}
+
+/*
+toFile returns the project as it should be written to disk. When an
+environment is selected, settings the environment overrides, settings
+changed during this run, and the deploy tracking fields go to the
+environment. The top level is written back exactly as it was loaded, so
+a run against one environment never changes what the others inherit.
+*/
+func (p *PusherProject) toFile() *PusherProject {
+	env := p.CurrentEnvironment()
+
+	if env == nil {
+		return p
+	}
+
+	result := *p
+
+	if env.CertEmail != "" || p.CertEmail != p.base.CertEmail {
+		env.CertEmail = p.CertEmail
+	}
+
+	if env.Domain != "" || p.Domain != p.base.Domain {
+		env.Domain = p.Domain
+	}
+
+	if env.EnvFile != "" || p.EnvFile != p.base.EnvFile {
+		env.EnvFile = p.EnvFile
+	}
+
+	if env.Host != "" || p.Host != p.base.Host {
+		env.Host = p.Host
+	}
+
+	if len(env.Mounts) > 0 || !reflect.DeepEqual(p.Mounts, p.base.Mounts) {
+		env.Mounts = p.Mounts
+	}
+
+	if env.Port != 0 || p.Port != p.base.Port {
+		env.Port = p.Port
+	}
+
+	if env.ServiceName != "" || p.ServiceName != p.base.ServiceName {
+		env.ServiceName = p.ServiceName
+	}
+
+	env.ActiveVersion = p.ActiveVersion
+	env.History = p.History
+	env.LastDeployDate = p.LastDeployDate
+	env.Version = p.Version
+
+	result.CertEmail = p.base.CertEmail
+	result.Domain = p.base.Domain
+	result.EnvFile = p.base.EnvFile
+	result.Host = p.base.Host
+	result.Mounts = p.base.Mounts
+	result.Port = p.base.Port
+	result.ServiceName = p.base.ServiceName
+
+	result.ActiveVersion = p.base.ActiveVersion
+	result.History = p.base.History
+	result.LastDeployDate = p.base.LastDeployDate
+	result.Version = p.base.Version
+
+	return &result
+}
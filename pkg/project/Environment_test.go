@@ -0,0 +1,168 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package project_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/adampresley/pusher/pkg/project"
+	"github.com/stretchr/testify/assert"
+)
+
+const environmentsFile = `domain: example.com
+host: production
+port: 3000
+servicename: myapp
+version: 4
+environments:
+  staging:
+    host: staging
+    version: 2
+`
+
+func TestSelectEnvironmentRoundTrip(t *testing.T) {
+	tests := []struct {
+		name        string
+		change      func(p *project.PusherProject)
+		wantTop     project.Environment
+		wantStaging project.Environment
+	}{
+		{
+			name:        "unchanged",
+			change:      func(p *project.PusherProject) {},
+			wantTop:     project.Environment{Domain: "example.com", Host: "production", Port: 3000, ServiceName: "myapp", Version: 4},
+			wantStaging: project.Environment{Host: "staging", Version: 2},
+		},
+		{
+			name:        "changing an overridden setting",
+			change:      func(p *project.PusherProject) { p.Host = "staging2" },
+			wantTop:     project.Environment{Domain: "example.com", Host: "production", Port: 3000, ServiceName: "myapp", Version: 4},
+			wantStaging: project.Environment{Host: "staging2", Version: 2},
+		},
+		{
+			name: "changing an inherited setting",
+			change: func(p *project.PusherProject) {
+				p.Domain = "staging.example.com"
+				p.Port = 3001
+				p.Mounts = project.Mounts{{Local: "./data", Remote: "/data"}}
+			},
+			wantTop: project.Environment{Domain: "example.com", Host: "production", Port: 3000, ServiceName: "myapp", Version: 4},
+			wantStaging: project.Environment{
+				Domain:  "staging.example.com",
+				Host:    "staging",
+				Mounts:  project.Mounts{{Local: "./data", Remote: "/data"}},
+				Port:    3001,
+				Version: 2,
+			},
+		},
+		{
+			name:        "deploying",
+			change:      func(p *project.PusherProject) { p.Version = 3; p.LastDeployDate = "today" },
+			wantTop:     project.Environment{Domain: "example.com", Host: "production", Port: 3000, ServiceName: "myapp", Version: 4},
+			wantStaging: project.Environment{Host: "staging", Version: 3, LastDeployDate: "today"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chdirTemp(t)
+			assert.NoError(t, os.WriteFile(project.PusherProjectFileName, []byte(environmentsFile), 0644))
+
+			staging := &project.PusherProject{}
+			assert.NoError(t, staging.LoadEnvironment("staging"))
+			assert.Equal(t, "example.com", staging.Domain, "staging inherits the domain")
+			assert.Equal(t, "staging", staging.Host)
+			assert.Equal(t, 2, staging.Version)
+
+			tt.change(staging)
+			assert.NoError(t, staging.Save())
+
+			top := &project.PusherProject{}
+			assert.NoError(t, top.Load())
+
+			assert.Equal(t, tt.wantStaging, *top.Environments["staging"])
+
+			assert.Equal(t, tt.wantTop, topLevel(top), "the top level is never changed")
+		})
+	}
+}
+
+func TestSelectEnvironmentCreate(t *testing.T) {
+	chdirTemp(t)
+	assert.NoError(t, os.WriteFile(project.PusherProjectFileName, []byte(environmentsFile), 0644))
+
+	p := &project.PusherProject{}
+	assert.Error(t, p.LoadEnvironment("qa"))
+
+	p = &project.PusherProject{}
+	assert.NoError(t, p.Load())
+	assert.NoError(t, p.SelectEnvironment("qa", true))
+
+	p.Host = "qa"
+	assert.NoError(t, p.Save())
+
+	saved := &project.PusherProject{}
+	assert.NoError(t, saved.LoadEnvironment("qa"))
+	assert.Equal(t, "qa", saved.Host)
+	assert.Equal(t, "example.com", saved.Domain)
+
+	production := &project.PusherProject{}
+	assert.NoError(t, production.Load())
+	assert.Equal(t, "production", production.Host)
+}
+
+/*
+topLevel returns the top level settings an environment can override.
+*/
+func topLevel(p *project.PusherProject) project.Environment {
+	result := project.Environment{
+		CertEmail:      p.CertEmail,
+		Domain:         p.Domain,
+		EnvFile:        p.EnvFile,
+		Host:           p.Host,
+		Port:           p.Port,
+		ServiceName:    p.ServiceName,
+		LastDeployDate: p.LastDeployDate,
+		Version:        p.Version,
+	}
+
+	if len(p.Mounts) > 0 {
+		result.Mounts = p.Mounts
+	}
+
+	return result
+}
+
+func chdirTemp(t *testing.T) {
+	wd, err := os.Getwd()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+}
@@ -0,0 +1,87 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package project
+
+import (
+	"strings"
+)
+
+const (
+	DefaultHealthCheckExpectedStatus int = 200
+	DefaultHealthCheckTimeout        int = 5
+	DefaultHealthCheckRetries        int = 10
+)
+
+/*
+HealthCheck describes an HTTP request pusher makes from the server
+to the application after it starts. The check is disabled when Path
+is empty.
+*/
+type HealthCheck struct {
+	Path           string
+	ExpectedStatus int
+	Timeout        int
+	Retries        int
+}
+
+func (h HealthCheck) IsEnabled() bool {
+	return h.Path != ""
+}
+
+/*
+GetPath returns the path to request, with the leading "/" added when
+it was left out.
+*/
+func (h HealthCheck) GetPath() string {
+	if h.Path == "" || strings.HasPrefix(h.Path, "/") {
+		return h.Path
+	}
+
+	return "/" + h.Path
+}
+
+func (h HealthCheck) GetExpectedStatus() int {
+	if h.ExpectedStatus <= 0 {
+		return DefaultHealthCheckExpectedStatus
+	}
+
+	return h.ExpectedStatus
+}
+
+/*
+GetTimeout returns the number of seconds to wait for each request.
+*/
+func (h HealthCheck) GetTimeout() int {
+	if h.Timeout <= 0 {
+		return DefaultHealthCheckTimeout
+	}
+
+	return h.Timeout
+}
+
+func (h HealthCheck) GetRetries() int {
+	if h.Retries <= 0 {
+		return DefaultHealthCheckRetries
+	}
+
+	return h.Retries
+}
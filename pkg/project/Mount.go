@@ -21,7 +21,11 @@ THE SOFTWARE.
 */
 package project
 
-import "fmt"
+import (
+	"fmt"
+	"path"
+	"strings"
+)
 
 type Mount struct {
 	Local  string
@@ -43,3 +47,41 @@ func (ms Mounts) ToStrings() []string {
 
 	return result
 }
+
+/*
+ServerPaths returns the folder on the server that each mount binds, the
+way docker compose resolves it: relative paths, which start with '.',
+are relative to applicationDir, where the compose file is. Named
+volumes aren't folders and are left out.
+*/
+func (ms Mounts) ServerPaths(applicationDir string) []string {
+	result := []string{}
+
+	for _, m := range ms {
+		switch {
+		case m.Local == "~", strings.HasPrefix(m.Local, "~/"), strings.HasPrefix(m.Local, "/"):
+			result = append(result, m.Local)
+
+		case strings.HasPrefix(m.Local, "."):
+			result = append(result, path.Join(applicationDir, m.Local))
+		}
+	}
+
+	return result
+}
+
+/*
+ParseMount parses a mount in the form "local:remote".
+*/
+func ParseMount(value string) (Mount, error) {
+	local, remote, found := strings.Cut(value, ":")
+
+	if !found || local == "" || remote == "" {
+		return Mount{}, fmt.Errorf("Invalid mount '%s'. Mounts must be in the form 'local:remote'", value)
+	}
+
+	return Mount{
+		Local:  local,
+		Remote: remote,
+	}, nil
+}
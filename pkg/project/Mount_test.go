@@ -0,0 +1,48 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package project_test
+
+import (
+	"testing"
+
+	"github.com/adampresley/pusher/pkg/project"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMountsServerPaths(t *testing.T) {
+	mounts := project.Mounts{
+		{Local: "./data", Remote: "/data"},
+		{Local: "../shared", Remote: "/shared"},
+		{Local: "~/uploads", Remote: "/uploads"},
+		{Local: "/srv/my files", Remote: "/files"},
+		{Local: "cache", Remote: "/cache"},
+	}
+
+	want := []string{
+		"~/applications/myapp/data",
+		"~/applications/shared",
+		"~/uploads",
+		"/srv/my files",
+	}
+
+	assert.Equal(t, want, mounts.ServerPaths("~/applications/myapp"))
+}
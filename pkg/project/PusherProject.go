@@ -24,26 +24,51 @@ package project
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
+	"github.com/adampresley/pusher/pkg/secrets"
 	"gopkg.in/yaml.v3"
 )
 
 const (
 	PusherProjectFileName string = "pusher.yaml"
+	DefaultKeepImages     int    = 5
+
+	DeployModeStandard  string = "standard"
+	DeployModeBlueGreen string = "bluegreen"
+
+	BuildLocal  string = "local"
+	BuildRemote string = "remote"
 )
 
 type PusherProject struct {
+	ActiveVersion  int
+	Build          string `yaml:",omitempty"`
 	CertEmail      string
+	Compression    string `yaml:",omitempty"`
 	Dependencies   []string
+	DeployMode     string
+	Docker         DockerBuild `yaml:",omitempty"`
 	Domain         string
 	EnvFile        string
+	EnvSchema      EnvSchema    `yaml:",omitempty"`
+	Environments   Environments `yaml:",omitempty"`
+	HealthCheck    HealthCheck
+	History        Deployments
 	Host           string
+	KeepImages     int
 	LastDeployDate string
 	Mounts         Mounts
 	Port           int
+	Recipients     []string `yaml:",omitempty"`
+	Registry       Registry `yaml:",omitempty"`
 	ServiceName    string
+	Transfer       string `yaml:",omitempty"`
 	Version        int
+
+	base            *PusherProject
+	environmentName string
 }
 
 func ProjectFileExists() bool {
@@ -52,6 +77,14 @@ func ProjectFileExists() bool {
 }
 
 func (p *PusherProject) Load() error {
+	return p.LoadEnvironment("")
+}
+
+/*
+LoadEnvironment loads the project file and selects a named environment
+from it. An empty name uses the top level settings only.
+*/
+func (p *PusherProject) LoadEnvironment(name string) error {
 	var (
 		err error
 		f   *os.File
@@ -61,13 +94,15 @@ func (p *PusherProject) Load() error {
 		return fmt.Errorf("There was an error trying to open the project file '%s': %s", PusherProjectFileName, err.Error())
 	}
 
+	defer f.Close()
+
 	decoder := yaml.NewDecoder(f)
 
 	if err = decoder.Decode(p); err != nil {
 		return fmt.Errorf("There was a problem decoding the project file '%s': %s", PusherProjectFileName, err.Error())
 	}
 
-	return nil
+	return p.SelectEnvironment(name, false)
 }
 
 func (p *PusherProject) Save() error {
@@ -77,7 +112,7 @@ func (p *PusherProject) Save() error {
 		f   *os.File
 	)
 
-	if out, err = yaml.Marshal(&p); err != nil {
+	if out, err = yaml.Marshal(p.toFile()); err != nil {
 		return fmt.Errorf("There was an error when converting project settings to YAML: %s", err.Error())
 	}
 
@@ -94,8 +129,112 @@ func (p *PusherProject) Save() error {
 	return nil
 }
 
+/*
+MountDirectories returns the folders on the server the application's
+mounts bind. ~ is the deploy user's home directory.
+*/
+func (p *PusherProject) MountDirectories() []string {
+	return p.Mounts.ServerPaths("~/applications/" + p.ServiceName)
+}
+
+/*
+GetKeepImages returns how many versioned images should be kept on
+the server. When not configured this defaults to DefaultKeepImages.
+*/
+func (p *PusherProject) GetKeepImages() int {
+	if p.KeepImages <= 0 {
+		return DefaultKeepImages
+	}
+
+	return p.KeepImages
+}
+
+/*
+IsBlueGreen returns true when the project is configured to deploy
+using blue/green containers instead of replacing a single container.
+*/
+func (p *PusherProject) IsBlueGreen() bool {
+	return p.DeployMode == DeployModeBlueGreen
+}
+
+/*
+UsesRemoteBuild returns true when the image is built on the server
+from a copy of the source tree instead of locally.
+*/
+func (p *PusherProject) UsesRemoteBuild() bool {
+	return p.Build == BuildRemote
+}
+
+/*
+UsesEncryptedEnvFile returns true when the env file is age encrypted
+and has to be decrypted before it is uploaded.
+*/
+func (p *PusherProject) UsesEncryptedEnvFile() bool {
+	return secrets.IsEncrypted(p.EnvFile)
+}
+
+/*
+RemoteEnvFileName is the name the env file has on the server. It is
+the file's base name, without the .age extension of an encrypted file.
+*/
+func (p *PusherProject) RemoteEnvFileName() string {
+	return filepath.Base(secrets.PlainName(p.EnvFile))
+}
+
+/*
+UsesRegistry returns true when images are pushed to a registry and
+pulled by the server instead of being uploaded as a tarball.
+*/
+func (p *PusherProject) UsesRegistry() bool {
+	return p.Transfer == TransferRegistry
+}
+
+/*
+UsesLayerTransfer returns true when only the image layers the server
+does not already have are uploaded.
+*/
+func (p *PusherProject) UsesLayerTransfer() bool {
+	return p.Transfer == TransferLayers
+}
+
+/*
+RegistryPullAddress returns the registry address as seen from the server.
+*/
+func (p *PusherProject) RegistryPullAddress() string {
+	if p.Registry.Local {
+		return LocalRegistryAddress
+	}
+
+	return p.Registry.Address
+}
+
+/*
+NextVersion returns the version number the next deploy will be tagged with.
+*/
+func (p *PusherProject) NextVersion() int {
+	return p.Version + 1
+}
+
 func (p *PusherProject) UpdateVersionAndDate() error {
 	p.Version++
+	p.ActiveVersion = p.Version
+	p.LastDeployDate = time.Now().Format(time.RFC3339)
+
+	p.History = append(p.History, Deployment{
+		Version: p.Version,
+		Date:    p.LastDeployDate,
+	})
+
+	p.History = p.History.Latest(p.GetKeepImages())
+	return p.Save()
+}
+
+/*
+RollbackTo marks a previously deployed version as the one
+currently running on the server.
+*/
+func (p *PusherProject) RollbackTo(version int) error {
+	p.ActiveVersion = version
 	p.LastDeployDate = time.Now().Format(time.RFC3339)
 
 	return p.Save()
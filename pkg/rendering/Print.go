@@ -23,6 +23,10 @@ package rendering
 
 import "github.com/pterm/pterm"
 
+var (
+	activeSpinner *pterm.SpinnerPrinter
+)
+
 func BlankLine() {
 	pterm.Println()
 }
@@ -46,15 +50,44 @@ func Print(message string, args ...any) {
 	pterm.DefaultBasicText.Printfln(message, args...)
 }
 
+func ProgressBar(title string, total int) *pterm.ProgressbarPrinter {
+	result, _ := pterm.DefaultProgressbar.
+		WithTitle(title).
+		WithTotal(total).
+		WithShowCount(false).
+		Start()
+
+	return result
+}
+
 func Spinner(message string) *pterm.SpinnerPrinter {
 	result, _ := pterm.DefaultSpinner.Start(message)
+	activeSpinner = result
 	return result
 }
 
+/*
+PauseSpinner stops the animation of the most recent spinner so a prompt
+can be shown without being drawn over. The spinner's Success and Fail
+messages still print when it finishes.
+*/
+func PauseSpinner() {
+	if activeSpinner != nil && activeSpinner.IsActive {
+		_ = activeSpinner.Stop()
+	}
+}
+
 func Success(message string, args ...any) {
 	pterm.Success.Printfln(message, args...)
 }
 
+/*
+Table renders rows as a table. The first row is the header.
+*/
+func Table(rows [][]string) {
+	_ = pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+}
+
 func Warning(message string, args ...any) {
 	pterm.Warning.Printfln(message, args...)
 }
@@ -0,0 +1,288 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package secrets
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"filippo.io/age/armor"
+	"github.com/adampresley/pusher/pkg/parsing"
+)
+
+const (
+	/*
+	 * EncryptedExtension marks an env file as age encrypted.
+	 */
+	EncryptedExtension string = ".age"
+
+	DefaultIdentityFile string = "~/.config/pusher/age.key"
+)
+
+/*
+IsEncrypted returns true when fileName is an age encrypted file.
+*/
+func IsEncrypted(fileName string) bool {
+	return strings.HasSuffix(fileName, EncryptedExtension)
+}
+
+/*
+PlainName returns the name of a file without its .age extension.
+*/
+func PlainName(fileName string) string {
+	return strings.TrimSuffix(fileName, EncryptedExtension)
+}
+
+/*
+Encrypt encrypts plaintext to every recipient. Recipients may be age
+public keys or SSH public keys. The result is ASCII armored so it can be
+committed and diffed like any other text file.
+*/
+func Encrypt(plaintext []byte, recipients []string) ([]byte, error) {
+	var (
+		err    error
+		parsed []age.Recipient
+		writer io.WriteCloser
+		output bytes.Buffer
+	)
+
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("There are no recipients to encrypt to")
+	}
+
+	if parsed, err = ParseRecipients(recipients); err != nil {
+		return nil, err
+	}
+
+	armorWriter := armor.NewWriter(&output)
+
+	if writer, err = age.Encrypt(armorWriter, parsed...); err != nil {
+		return nil, fmt.Errorf("There was a problem encrypting: %s", err.Error())
+	}
+
+	if _, err = writer.Write(plaintext); err != nil {
+		return nil, fmt.Errorf("There was a problem encrypting: %s", err.Error())
+	}
+
+	if err = writer.Close(); err != nil {
+		return nil, fmt.Errorf("There was a problem encrypting: %s", err.Error())
+	}
+
+	if err = armorWriter.Close(); err != nil {
+		return nil, fmt.Errorf("There was a problem encrypting: %s", err.Error())
+	}
+
+	return output.Bytes(), nil
+}
+
+/*
+Decrypt decrypts an armored or binary age file with the given identities.
+*/
+func Decrypt(ciphertext []byte, identities []age.Identity) ([]byte, error) {
+	var (
+		err    error
+		reader io.Reader = bytes.NewReader(ciphertext)
+	)
+
+	if bytes.HasPrefix(bytes.TrimSpace(ciphertext), []byte(armor.Header)) {
+		reader = armor.NewReader(bytes.NewReader(bytes.TrimSpace(ciphertext)))
+	}
+
+	if reader, err = age.Decrypt(reader, identities...); err != nil {
+		return nil, fmt.Errorf("There was a problem decrypting: %s", err.Error())
+	}
+
+	return io.ReadAll(reader)
+}
+
+/*
+DecryptFile reads and decrypts an age encrypted file using the identities
+from LoadIdentities.
+*/
+func DecryptFile(fileName string) ([]byte, error) {
+	var (
+		err        error
+		b          []byte
+		identities []age.Identity
+	)
+
+	if identities, err = LoadIdentities(); err != nil {
+		return nil, err
+	}
+
+	if b, err = os.ReadFile(fileName); err != nil {
+		return nil, err
+	}
+
+	return Decrypt(b, identities)
+}
+
+/*
+ParseRecipients parses age public keys (age1...) and SSH public keys
+(ssh-ed25519 ..., ssh-rsa ...).
+*/
+func ParseRecipients(recipients []string) ([]age.Recipient, error) {
+	result := []age.Recipient{}
+
+	for _, r := range recipients {
+		var (
+			err    error
+			parsed age.Recipient
+		)
+
+		r = strings.TrimSpace(r)
+
+		if strings.HasPrefix(r, "ssh-") {
+			parsed, err = agessh.ParseRecipient(r)
+		} else {
+			parsed, err = age.ParseX25519Recipient(r)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a valid recipient: %s", r, err.Error())
+		}
+
+		result = append(result, parsed)
+	}
+
+	return result, nil
+}
+
+/*
+IdentityFile returns the path of the age key used to decrypt. It can be
+changed with the PUSHER_AGE_IDENTITY environment variable.
+*/
+func IdentityFile() string {
+	if value := os.Getenv("PUSHER_AGE_IDENTITY"); value != "" {
+		return parsing.ExpandHomeDir(value)
+	}
+
+	return parsing.ExpandHomeDir(DefaultIdentityFile)
+}
+
+/*
+LoadIdentities returns the age identities used to decrypt. The key
+itself can be given in the PUSHER_AGE_KEY environment variable, which is
+handy in CI. Otherwise it is read from IdentityFile. Either may hold age
+keys or an unencrypted SSH private key.
+*/
+func LoadIdentities() ([]age.Identity, error) {
+	var (
+		err    error
+		result []age.Identity
+		b      []byte
+	)
+
+	if value := os.Getenv("PUSHER_AGE_KEY"); value != "" {
+		if result, err = parseIdentities([]byte(value)); err != nil {
+			return nil, fmt.Errorf("PUSHER_AGE_KEY does not contain a valid key: %s", err.Error())
+		}
+
+		return result, nil
+	}
+
+	fileName := IdentityFile()
+
+	if b, err = os.ReadFile(fileName); err != nil {
+		return nil, fmt.Errorf("Unable to open age key '%s': %s", fileName, err.Error())
+	}
+
+	if result, err = parseIdentities(b); err != nil {
+		return nil, fmt.Errorf("'%s' does not contain a valid key: %s", fileName, err.Error())
+	}
+
+	return result, nil
+}
+
+func parseIdentities(b []byte) ([]age.Identity, error) {
+	if bytes.Contains(b, []byte("PRIVATE KEY-----")) {
+		identity, err := agessh.ParseIdentity(b)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return []age.Identity{identity}, nil
+	}
+
+	return age.ParseIdentities(bytes.NewReader(b))
+}
+
+/*
+GenerateIdentity creates a new age key at IdentityFile and returns its
+public key. It fails if the file already exists.
+*/
+func GenerateIdentity() (string, error) {
+	var (
+		err      error
+		identity *age.X25519Identity
+		f        *os.File
+	)
+
+	fileName := IdentityFile()
+
+	if identity, err = age.GenerateX25519Identity(); err != nil {
+		return "", fmt.Errorf("There was a problem generating an age key: %s", err.Error())
+	}
+
+	if err = os.MkdirAll(filepath.Dir(fileName), 0700); err != nil {
+		return "", err
+	}
+
+	if f, err = os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600); err != nil {
+		return "", fmt.Errorf("Unable to create age key '%s': %s", fileName, err.Error())
+	}
+
+	defer f.Close()
+
+	if _, err = fmt.Fprintf(f, "# public key: %s\n%s\n", identity.Recipient().String(), identity.String()); err != nil {
+		return "", err
+	}
+
+	return identity.Recipient().String(), nil
+}
+
+/*
+PublicKey returns the public key of the identity at IdentityFile, or an
+empty string if it isn't a native age key.
+*/
+func PublicKey() (string, error) {
+	identities, err := LoadIdentities()
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, identity := range identities {
+		if x, ok := identity.(*age.X25519Identity); ok {
+			return x.Recipient().String(), nil
+		}
+	}
+
+	return "", nil
+}
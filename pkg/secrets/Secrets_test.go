@@ -0,0 +1,56 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package secrets_test
+
+import (
+	"testing"
+
+	"filippo.io/age"
+	"github.com/adampresley/pusher/pkg/secrets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	other, _ := age.GenerateX25519Identity()
+
+	ciphertext, err := secrets.Encrypt([]byte("API_TOKEN=abc\n"), []string{identity.Recipient().String()})
+	assert.NoError(t, err)
+	assert.Contains(t, string(ciphertext), "-----BEGIN AGE ENCRYPTED FILE-----")
+
+	t.Run("decrypts with a recipient's key", func(t *testing.T) {
+		plaintext, err := secrets.Decrypt(ciphertext, []age.Identity{identity})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "API_TOKEN=abc\n", string(plaintext))
+	})
+
+	t.Run("fails with any other key", func(t *testing.T) {
+		_, err := secrets.Decrypt(ciphertext, []age.Identity{other})
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects invalid recipients", func(t *testing.T) {
+		_, err := secrets.Encrypt([]byte("A=1"), []string{"not-a-key"})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,54 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package services
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+type composeFile struct {
+	Services map[string]struct {
+		Environment map[string]string
+	}
+}
+
+/*
+ComposeEnvironment returns the environment a service sets in its
+docker-compose.yml on the server.
+*/
+func ComposeEnvironment(b []byte, service string) (map[string]string, error) {
+	compose := composeFile{}
+
+	if err := yaml.Unmarshal(b, &compose); err != nil {
+		return nil, fmt.Errorf("Unable to read the compose file for '%s': %s", service, err.Error())
+	}
+
+	result := compose.Services[service].Environment
+
+	if result == nil {
+		result = map[string]string{}
+	}
+
+	return result, nil
+}
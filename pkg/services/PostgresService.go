@@ -22,6 +22,9 @@ THE SOFTWARE.
 package services
 
 import (
+	"fmt"
+	"net/url"
+
 	"github.com/adampresley/pusher/pkg/commands"
 	"github.com/adampresley/pusher/pkg/contextinfo"
 	"github.com/pterm/pterm"
@@ -31,7 +34,9 @@ var PostgresService = ServiceItem{
 	ServiceName: "PostgreSQL",
 	Description: `PostgreSQL is a powerful, open source object-relational
 database system`,
-	Step: &commands.SetupServicePostgresCommand,
+	Step:      &commands.SetupServicePostgresCommand,
+	Container: "postgres",
+	Port:      5432,
 	Collector: func(info *contextinfo.ContextInfo) {
 		info.Env = map[string]string{}
 
@@ -49,4 +54,27 @@ database system`,
 			info.Env["POSTGRES_DB"] = database
 		}
 	},
+	ConnectionString: func(env map[string]string, localPort int) string {
+		user := env["POSTGRES_USER"]
+
+		if user == "" {
+			user = "postgres"
+		}
+
+		database := env["POSTGRES_DB"]
+
+		if database == "" {
+			database = user
+		}
+
+		u := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(user, env["POSTGRES_PASSWORD"]),
+			Host:     fmt.Sprintf("localhost:%d", localPort),
+			Path:     "/" + database,
+			RawQuery: "sslmode=disable",
+		}
+
+		return u.String()
+	},
 }
@@ -0,0 +1,43 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package services
+
+import (
+	"fmt"
+
+	"github.com/adampresley/pusher/pkg/commands"
+	"github.com/adampresley/pusher/pkg/contextinfo"
+)
+
+var RegistryService = ServiceItem{
+	ServiceName: "Docker Registry",
+	Description: `A private Docker registry on your server. Use it to deploy
+with 'transfer: registry' and 'registry: {local: true}' so only
+changed image layers are uploaded`,
+	Step:      &commands.SetupServiceRegistryCommand,
+	Collector: func(info *contextinfo.ContextInfo) {},
+	Container: "registry",
+	Port:      5000,
+	ConnectionString: func(env map[string]string, localPort int) string {
+		return fmt.Sprintf("localhost:%d", localPort)
+	},
+}
@@ -32,11 +32,24 @@ type ServiceItem struct {
 	Description string
 	Step        *sshutils.Step
 	Collector   func(info *contextinfo.ContextInfo)
+
+	// Container is the name of the service's container, and of its
+	// folder in ~/services.
+	Container string
+
+	// Port is where the service listens on the server's loopback address.
+	Port int
+
+	// ConnectionString, when set, returns how to connect to the service
+	// through a tunnel on localPort. env is the environment from the
+	// service's compose file.
+	ConnectionString func(env map[string]string, localPort int) string
 }
 
 var (
 	ServiceList = []ServiceItem{
 		PostgresService,
+		RegistryService,
 	}
 )
 
@@ -57,3 +70,13 @@ func GetServiceByName(name string) ServiceItem {
 		return false
 	})
 }
+
+func GetServiceByContainer(container string) (ServiceItem, bool) {
+	for _, item := range ServiceList {
+		if item.Container == container {
+			return item, true
+		}
+	}
+
+	return ServiceItem{}, false
+}
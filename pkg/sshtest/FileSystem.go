@@ -0,0 +1,209 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package sshtest
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+/*
+fileSystem keeps uploaded files in memory. There are no directories:
+the commands that would create them aren't really run, so any path can
+be written.
+*/
+type fileSystem struct {
+	lock  sync.Mutex
+	files map[string]*memoryFile
+}
+
+type memoryFile struct {
+	fileSystem *fileSystem
+	name       string
+	contents   []byte
+	mode       os.FileMode
+}
+
+func newFileSystem() *fileSystem {
+	return &fileSystem{
+		files: map[string]*memoryFile{},
+	}
+}
+
+func (fs *fileSystem) handlers() sftp.Handlers {
+	return sftp.Handlers{
+		FileGet:  fs,
+		FilePut:  fs,
+		FileCmd:  fs,
+		FileList: fs,
+	}
+}
+
+/*
+key turns an SFTP path, which the server makes absolute, back into one
+relative to the home directory.
+*/
+func key(name string) string {
+	return strings.TrimPrefix(path.Clean(name), "/")
+}
+
+func (fs *fileSystem) get(name string) ([]byte, bool) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	f, found := fs.files[key(name)]
+
+	if !found {
+		return nil, false
+	}
+
+	return append([]byte{}, f.contents...), true
+}
+
+func (fs *fileSystem) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	contents, found := fs.get(r.Filepath)
+
+	if !found {
+		return nil, os.ErrNotExist
+	}
+
+	return bytes.NewReader(contents), nil
+}
+
+func (fs *fileSystem) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	name := key(r.Filepath)
+	f, found := fs.files[name]
+
+	if !found {
+		f = &memoryFile{fileSystem: fs, name: name, mode: 0644}
+		fs.files[name] = f
+	}
+
+	if r.Pflags().Trunc {
+		f.contents = nil
+	}
+
+	return f, nil
+}
+
+func (fs *fileSystem) Filecmd(r *sftp.Request) error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	name := key(r.Filepath)
+
+	switch r.Method {
+	case "Setstat":
+		if f, found := fs.files[name]; found && r.AttrFlags().Permissions {
+			f.mode = r.Attributes().FileMode().Perm()
+		}
+
+	case "Remove":
+		if _, found := fs.files[name]; !found {
+			return os.ErrNotExist
+		}
+
+		delete(fs.files, name)
+
+	case "Rename":
+		f, found := fs.files[name]
+
+		if !found {
+			return os.ErrNotExist
+		}
+
+		delete(fs.files, name)
+		f.name = key(r.Target)
+		fs.files[f.name] = f
+	}
+
+	return nil
+}
+
+func (fs *fileSystem) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	switch r.Method {
+	case "Stat", "Lstat":
+		f, found := fs.files[key(r.Filepath)]
+
+		if !found {
+			return nil, os.ErrNotExist
+		}
+
+		return listerAt{fileInfo{name: path.Base(f.name), size: int64(len(f.contents)), mode: f.mode}}, nil
+	}
+
+	return listerAt{}, nil
+}
+
+func (f *memoryFile) WriteAt(b []byte, offset int64) (int, error) {
+	f.fileSystem.lock.Lock()
+	defer f.fileSystem.lock.Unlock()
+
+	if end := offset + int64(len(b)); end > int64(len(f.contents)) {
+		f.contents = append(f.contents, make([]byte, end-int64(len(f.contents)))...)
+	}
+
+	copy(f.contents[offset:], b)
+	return len(b), nil
+}
+
+type listerAt []os.FileInfo
+
+func (l listerAt) ListAt(result []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+
+	n := copy(result, l[offset:])
+
+	if n < len(result) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+type fileInfo struct {
+	name string
+	size int64
+	mode os.FileMode
+}
+
+func (i fileInfo) Name() string       { return i.name }
+func (i fileInfo) Size() int64        { return i.size }
+func (i fileInfo) Mode() os.FileMode  { return i.mode }
+func (i fileInfo) ModTime() time.Time { return time.Time{} }
+func (i fileInfo) IsDir() bool        { return false }
+func (i fileInfo) Sys() any           { return nil }
@@ -0,0 +1,150 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package sshtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/adampresley/pusher/pkg/sshutils"
+)
+
+/*
+Upload is a file a Recorder was asked to upload.
+*/
+type Upload struct {
+	RemotePath string
+	Contents   []byte
+}
+
+/*
+Recorder is a fake sshutils.Executor. It records every command and
+upload, and answers commands with Handler, which succeeds with no output
+when it is nil. A non-zero status is returned as an error. Nothing is
+recorded once ctx is cancelled.
+*/
+type Recorder struct {
+	Handler Handler
+
+	lock    sync.Mutex
+	execs   []Exec
+	uploads []Upload
+}
+
+var _ sshutils.Executor = (*Recorder)(nil)
+
+func (r *Recorder) Run(ctx context.Context, command string) ([]byte, error) {
+	return r.Stream(ctx, command, nil)
+}
+
+func (r *Recorder) Stream(ctx context.Context, command string, input io.Reader) ([]byte, error) {
+	var (
+		err   error
+		stdin []byte
+	)
+
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if input != nil {
+		if stdin, err = io.ReadAll(input); err != nil {
+			return nil, err
+		}
+	}
+
+	r.lock.Lock()
+	r.execs = append(r.execs, Exec{Command: command, Stdin: stdin})
+	handler := r.Handler
+	r.lock.Unlock()
+
+	if handler == nil {
+		return nil, nil
+	}
+
+	output, status := handler(command, stdin)
+
+	if status != 0 {
+		return []byte(output), fmt.Errorf("Process exited with status %d", status)
+	}
+
+	return []byte(output), nil
+}
+
+func (r *Recorder) Upload(ctx context.Context, upload sshutils.FileUpload, remotePath string, debug bool) error {
+	var (
+		err      error
+		contents = upload.Contents
+	)
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	if contents == nil {
+		if contents, err = os.ReadFile(upload.LocalPath); err != nil {
+			return err
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.uploads = append(r.uploads, Upload{RemotePath: remotePath, Contents: contents})
+	return nil
+}
+
+/*
+Execs returns the commands run so far, in order.
+*/
+func (r *Recorder) Execs() []Exec {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return append([]Exec{}, r.execs...)
+}
+
+/*
+Commands returns just the command lines run so far, in order.
+*/
+func (r *Recorder) Commands() []string {
+	result := []string{}
+
+	for _, exec := range r.Execs() {
+		result = append(result, exec.Command)
+	}
+
+	return result
+}
+
+/*
+Uploads returns the files uploaded so far, in order.
+*/
+func (r *Recorder) Uploads() []Upload {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return append([]Upload{}, r.uploads...)
+}
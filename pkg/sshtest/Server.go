@@ -0,0 +1,329 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+/*
+Package sshtest has an SSH server that runs inside a test, and a fake
+sshutils.Executor. Both record what they are asked to do, so tests can
+check the exact commands a flow sends without a real server.
+*/
+package sshtest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/melbahja/goph"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+/*
+Handler returns the output and exit status of a command. stdin is
+everything the client sent before closing its input.
+*/
+type Handler func(command string, stdin []byte) (string, int)
+
+/*
+Exec is a command the server was asked to run.
+*/
+type Exec struct {
+	Command string
+	Stdin   []byte
+}
+
+/*
+Server is an SSH server on a local port. It doesn't run anything: every
+command goes to Handler, which succeeds with no output when it is nil.
+SFTP is supported, and uploaded files are kept in memory.
+*/
+type Server struct {
+	Address string
+	HostKey ssh.Signer
+	User    string
+
+	// ClientKey is the only key the server accepts.
+	ClientKey ssh.Signer
+
+	Handler Handler
+
+	lock    sync.Mutex
+	execs   []Exec
+	signals []string
+	offered []ssh.PublicKey
+	files   *fileSystem
+}
+
+/*
+NewServer starts a server that stops when the test ends.
+*/
+func NewServer(t testing.TB) *Server {
+	var (
+		err      error
+		listener net.Listener
+	)
+
+	result := &Server{
+		HostKey:   newSigner(t),
+		ClientKey: newSigner(t),
+		User:      "pusher",
+		files:     newFileSystem(),
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			result.lock.Lock()
+			result.offered = append(result.offered, key)
+			result.lock.Unlock()
+
+			if conn.User() == result.User && bytes.Equal(key.Marshal(), result.ClientKey.PublicKey().Marshal()) {
+				return nil, nil
+			}
+
+			return nil, errors.New("unknown key")
+		},
+	}
+
+	config.AddHostKey(result.HostKey)
+
+	if listener, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { listener.Close() })
+	result.Address = listener.Addr().String()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go result.serve(conn, config)
+		}
+	}()
+
+	return result
+}
+
+/*
+Dial connects to the server as User, checking its host key.
+*/
+func (s *Server) Dial(t testing.TB) *goph.Client {
+	host, port, _ := net.SplitHostPort(s.Address)
+	portNumber, _ := strconv.Atoi(port)
+
+	config := &goph.Config{
+		User:     s.User,
+		Addr:     host,
+		Port:     uint(portNumber),
+		Auth:     goph.Auth{ssh.PublicKeys(s.ClientKey)},
+		Timeout:  5 * time.Second,
+		Callback: ssh.FixedHostKey(s.HostKey.PublicKey()),
+	}
+
+	client, err := goph.NewConn(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+/*
+Execs returns the commands run so far, in order.
+*/
+func (s *Server) Execs() []Exec {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]Exec{}, s.execs...)
+}
+
+/*
+Commands returns just the command lines run so far, in order.
+*/
+func (s *Server) Commands() []string {
+	result := []string{}
+
+	for _, exec := range s.Execs() {
+		result = append(result, exec.Command)
+	}
+
+	return result
+}
+
+/*
+Signals returns the names of the signals clients sent to running
+commands, such as "TERM", in order.
+*/
+func (s *Server) Signals() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]string{}, s.signals...)
+}
+
+/*
+OfferedKeys returns the public keys clients offered to log in with, in
+order.
+*/
+func (s *Server) OfferedKeys() []ssh.PublicKey {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]ssh.PublicKey{}, s.offered...)
+}
+
+/*
+File returns the contents of an uploaded file. Paths are relative to the
+home directory, as pusher uploads them.
+*/
+func (s *Server) File(path string) ([]byte, bool) {
+	return s.files.get(path)
+}
+
+func (s *Server) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+
+		channel, channelRequests, err := newChannel.Accept()
+
+		if err != nil {
+			continue
+		}
+
+		go s.session(channel, channelRequests)
+	}
+}
+
+/*
+session answers the requests on a channel. A command runs in the
+background, so signals sent while it runs are still received.
+*/
+func (s *Server) session(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+
+	for request := range requests {
+		switch request.Type {
+		case "exec":
+			var payload struct{ Command string }
+
+			if err := ssh.Unmarshal(request.Payload, &payload); err != nil {
+				_ = request.Reply(false, nil)
+				continue
+			}
+
+			_ = request.Reply(true, nil)
+			go s.exec(channel, payload.Command)
+
+		case "signal":
+			var payload struct{ Signal string }
+
+			if err := ssh.Unmarshal(request.Payload, &payload); err == nil {
+				s.lock.Lock()
+				s.signals = append(s.signals, payload.Signal)
+				s.lock.Unlock()
+			}
+
+			_ = request.Reply(false, nil)
+
+		case "subsystem":
+			var payload struct{ Name string }
+
+			if err := ssh.Unmarshal(request.Payload, &payload); err != nil || payload.Name != "sftp" {
+				_ = request.Reply(false, nil)
+				continue
+			}
+
+			_ = request.Reply(true, nil)
+			server := sftp.NewRequestServer(channel, s.files.handlers())
+			_ = server.Serve()
+			return
+
+		default:
+			_ = request.Reply(false, nil)
+		}
+	}
+}
+
+func (s *Server) exec(channel ssh.Channel, command string) {
+	stdin, _ := io.ReadAll(channel)
+
+	s.lock.Lock()
+	s.execs = append(s.execs, Exec{Command: command, Stdin: stdin})
+	handler := s.Handler
+	s.lock.Unlock()
+
+	output, status := "", 0
+
+	if handler != nil {
+		output, status = handler(command, stdin)
+	}
+
+	_, _ = io.WriteString(channel, output)
+
+	exitStatus := make([]byte, 4)
+	binary.BigEndian.PutUint32(exitStatus, uint32(status))
+	_, _ = channel.SendRequest("exit-status", false, exitStatus)
+	_ = channel.Close()
+}
+
+func newSigner(t testing.TB) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ssh.NewSignerFromKey(key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
@@ -0,0 +1,406 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package sshutils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/adampresley/pusher/pkg/parsing"
+	"github.com/adampresley/pusher/pkg/rendering"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/term"
+)
+
+const (
+	maxPassphraseAttempts int = 3
+)
+
+/*
+PassphrasePrompt asks for the passphrase of the SSH key in fileName.
+*/
+type PassphrasePrompt func(fileName string) ([]byte, error)
+
+var (
+	/*
+	 * AskPassphrase is how passphrases are asked for. By default they are
+	 * read from the terminal without being echoed.
+	 */
+	AskPassphrase PassphrasePrompt = terminalPassphrase
+
+	/*
+	 * Keys unlocked with a passphrase are kept for the life of the process,
+	 * so a jump host and the server behind it only ask once.
+	 */
+	unlockedKeys     = map[string]ssh.Signer{}
+	unlockedKeysLock sync.Mutex
+)
+
+/*
+authMethods returns the ways to authenticate to host, the way OpenSSH
+does. Keys in ssh-agent are offered first, then each IdentityFile. With
+IdentitiesOnly, only agent keys that belong to an IdentityFile are
+offered. Passphrase protected keys are only unlocked when the server
+would accept them. An IdentityFile that is missing or can't be parsed is
+skipped, but its .pub file still picks the matching agent key, which is
+how keys that live on a security key are used.
+*/
+func authMethods(host parsing.SSHHost) ([]ssh.AuthMethod, error) {
+	var (
+		err        error
+		identities []identity
+	)
+
+	signers := []ssh.Signer{}
+	identitiesOnly := strings.EqualFold(host.Option("IdentitiesOnly"), "yes")
+
+	for _, fileName := range host.IdentityFiles {
+		var id identity
+
+		if id, err = loadIdentity(fileName); err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				rendering.Warning("%s. Skipping it.", err.Error())
+			}
+
+			if publicKey, pubErr := readPublicKey(fileName + ".pub"); pubErr == nil {
+				identities = append(identities, identity{fileName: fileName, publicKey: publicKey})
+			}
+
+			continue
+		}
+
+		identities = append(identities, id)
+	}
+
+	for _, signer := range agentSigners(host) {
+		if identitiesOnly && !containsKey(identities, signer.PublicKey()) {
+			continue
+		}
+
+		signers = append(signers, signer)
+	}
+
+	for _, id := range identities {
+		if id.signer == nil || hasSigner(signers, id.publicKey) {
+			continue
+		}
+
+		signers = append(signers, id.signer)
+	}
+
+	if len(signers) == 0 {
+		return nil, fmt.Errorf("No SSH keys to authenticate with. Add an IdentityFile to your SSH config for '%s', or add a key to ssh-agent", host.Alias)
+	}
+
+	return []ssh.AuthMethod{ssh.PublicKeys(signers...)}, nil
+}
+
+/*
+agentSocket returns the path of the ssh-agent socket to use for host, or
+an empty string when there isn't one. IdentityAgent in the SSH config
+wins over SSH_AUTH_SOCK, and "none" turns the agent off.
+*/
+func agentSocket(host parsing.SSHHost) string {
+	result := os.Getenv("SSH_AUTH_SOCK")
+	identityAgent := host.Option("IdentityAgent")
+
+	switch {
+	case strings.EqualFold(identityAgent, "none"):
+		return ""
+
+	case identityAgent == "" || identityAgent == "SSH_AUTH_SOCK":
+
+	case strings.HasPrefix(identityAgent, "$"):
+		result = os.Getenv(strings.TrimPrefix(identityAgent, "$"))
+
+	default:
+		result = identityAgent
+	}
+
+	if result == "" {
+		return ""
+	}
+
+	if _, err := os.Stat(result); err != nil {
+		return ""
+	}
+
+	return result
+}
+
+/*
+agentSigners returns the keys in ssh-agent. An agent that can't be
+reached is treated as having no keys.
+*/
+func agentSigners(host parsing.SSHHost) []ssh.Signer {
+	var (
+		err     error
+		conn    net.Conn
+		signers []ssh.Signer
+	)
+
+	socket := agentSocket(host)
+
+	if socket == "" {
+		return nil
+	}
+
+	if conn, err = net.Dial("unix", socket); err != nil {
+		return nil
+	}
+
+	if signers, err = agent.NewClient(conn).Signers(); err != nil {
+		conn.Close()
+		return nil
+	}
+
+	return signers
+}
+
+/*
+identity is a key from an IdentityFile. Its signer may still be locked,
+and is nil when only the public key could be read.
+*/
+type identity struct {
+	fileName  string
+	publicKey ssh.PublicKey
+	signer    ssh.Signer
+}
+
+func loadIdentity(fileName string) (identity, error) {
+	var (
+		err       error
+		contents  []byte
+		signer    ssh.Signer
+		publicKey ssh.PublicKey
+	)
+
+	result := identity{fileName: fileName}
+
+	unlockedKeysLock.Lock()
+	signer, unlocked := unlockedKeys[fileName]
+	unlockedKeysLock.Unlock()
+
+	if unlocked {
+		result.signer = signer
+		result.publicKey = signer.PublicKey()
+		return result, nil
+	}
+
+	if contents, err = os.ReadFile(fileName); err != nil {
+		return result, err
+	}
+
+	signer, err = ssh.ParsePrivateKey(contents)
+
+	if err == nil {
+		result.signer = signer
+		result.publicKey = signer.PublicKey()
+		return result, nil
+	}
+
+	var missing *ssh.PassphraseMissingError
+
+	if !errors.As(err, &missing) {
+		return result, fmt.Errorf("There was an error parsing your SSH key '%s': %s", fileName, err.Error())
+	}
+
+	/*
+	 * Newer key files carry their public key in the clear. Older ones
+	 * need the .pub file next to them, or they are unlocked right away.
+	 */
+	publicKey = missing.PublicKey
+
+	if publicKey == nil {
+		publicKey, _ = readPublicKey(fileName + ".pub")
+	}
+
+	if publicKey == nil {
+		if signer, err = unlockKey(fileName, contents); err != nil {
+			return result, err
+		}
+
+		result.signer = signer
+		result.publicKey = signer.PublicKey()
+		return result, nil
+	}
+
+	result.publicKey = publicKey
+	result.signer = &lockedSigner{
+		fileName:  fileName,
+		contents:  contents,
+		publicKey: publicKey,
+	}
+
+	return result, nil
+}
+
+func readPublicKey(fileName string) (ssh.PublicKey, error) {
+	contents, err := os.ReadFile(fileName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, _, _, _, err := ssh.ParseAuthorizedKey(contents)
+	return result, err
+}
+
+/*
+unlockKey asks for the passphrase of a key, giving a few tries.
+*/
+func unlockKey(fileName string, contents []byte) (ssh.Signer, error) {
+	var (
+		err        error
+		passphrase []byte
+		result     ssh.Signer
+	)
+
+	for attempt := 0; attempt < maxPassphraseAttempts; attempt++ {
+		if passphrase, err = AskPassphrase(fileName); err != nil {
+			return nil, err
+		}
+
+		if len(passphrase) == 0 {
+			return nil, fmt.Errorf("No passphrase given for the SSH key '%s'", fileName)
+		}
+
+		if result, err = ssh.ParsePrivateKeyWithPassphrase(contents, passphrase); err == nil {
+			unlockedKeysLock.Lock()
+			unlockedKeys[fileName] = result
+			unlockedKeysLock.Unlock()
+
+			return result, nil
+		}
+
+		fmt.Fprintln(os.Stderr, "Bad passphrase, try again.")
+	}
+
+	return nil, fmt.Errorf("Unable to unlock the SSH key '%s': %s", fileName, err.Error())
+}
+
+func terminalPassphrase(fileName string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("The SSH key '%s' needs a passphrase, but there is no terminal to ask for it. Add the key to ssh-agent instead", fileName)
+	}
+
+	rendering.PauseSpinner()
+
+	fmt.Fprintf(os.Stderr, "Enter passphrase for key '%s': ", fileName)
+	result, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+
+	if err != nil {
+		return nil, fmt.Errorf("There was a problem reading the passphrase: %s", err.Error())
+	}
+
+	return result, nil
+}
+
+/*
+lockedSigner is a passphrase protected key. The passphrase is only asked
+for when the server accepts the key and something needs signing.
+*/
+type lockedSigner struct {
+	fileName  string
+	contents  []byte
+	publicKey ssh.PublicKey
+
+	lock   sync.Mutex
+	signer ssh.Signer
+}
+
+func (s *lockedSigner) PublicKey() ssh.PublicKey {
+	return s.publicKey
+}
+
+func (s *lockedSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	signer, err := s.unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return signer.Sign(rand, data)
+}
+
+func (s *lockedSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	signer, err := s.unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if algorithmSigner, ok := signer.(ssh.AlgorithmSigner); ok {
+		return algorithmSigner.SignWithAlgorithm(rand, data, algorithm)
+	}
+
+	return signer.Sign(rand, data)
+}
+
+func (s *lockedSigner) unlock() (ssh.Signer, error) {
+	var (
+		err error
+	)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.signer == nil {
+		s.signer, err = unlockKey(s.fileName, s.contents)
+	}
+
+	return s.signer, err
+}
+
+func containsKey(identities []identity, key ssh.PublicKey) bool {
+	for _, id := range identities {
+		if sameKey(id.publicKey, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasSigner(signers []ssh.Signer, key ssh.PublicKey) bool {
+	for _, signer := range signers {
+		if sameKey(signer.PublicKey(), key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sameKey(a, b ssh.PublicKey) bool {
+	return bytes.Equal(a.Marshal(), b.Marshal())
+}
@@ -21,14 +21,103 @@ THE SOFTWARE.
 */
 package sshutils
 
+import (
+	"time"
+)
+
+/*
+Command is a single command in a Step. By default it runs once, for as
+long as it takes. Retry and Timeout are for commands that can hang or
+fail on a bad network, such as package installs and downloads, and
+should only be set on commands that are safe to run again.
+*/
 type Command struct {
 	Command string
 	Message string
+
+	// Retry is how many times to run the command, and how long to wait
+	// between attempts, before giving up.
+	Retry RetryPolicy
+
+	// Timeout stops an attempt that runs longer than this. Zero means no limit.
+	Timeout time.Duration
+}
+
+/*
+RetryPolicy runs a failed command again, waiting Delay before the first
+retry and doubling the wait each time after, up to MaxDelay.
+*/
+type RetryPolicy struct {
+	Attempts int
+	Delay    time.Duration
+	MaxDelay time.Duration
 }
 
+var (
+	/*
+	 * NetworkRetry suits commands that download from the internet, which
+	 * usually recover from a blip within a minute.
+	 */
+	NetworkRetry = RetryPolicy{
+		Attempts: 3,
+		Delay:    5 * time.Second,
+		MaxDelay: 30 * time.Second,
+	}
+)
+
 func NewCommand(command, message string) Command {
 	return Command{
 		Command: command,
 		Message: message,
 	}
 }
+
+/*
+WithRetry returns a copy of the command that runs again when it fails.
+*/
+func (c Command) WithRetry(policy RetryPolicy) Command {
+	c.Retry = policy
+	return c
+}
+
+/*
+WithTimeout returns a copy of the command that stops each attempt after
+timeout.
+*/
+func (c Command) WithTimeout(timeout time.Duration) Command {
+	c.Timeout = timeout
+	return c
+}
+
+/*
+attempts is how many times to run a command in total. It is always at
+least one.
+*/
+func (p RetryPolicy) attempts() int {
+	if p.Attempts < 1 {
+		return 1
+	}
+
+	return p.Attempts
+}
+
+/*
+delay is how long to wait after the given failed attempt, counting from 1.
+*/
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	result := p.Delay
+
+	for i := 1; i < attempt && result > 0; i++ {
+		result *= 2
+
+		if p.MaxDelay > 0 && result >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+
+	if p.MaxDelay > 0 && result > p.MaxDelay {
+		return p.MaxDelay
+	}
+
+	return result
+}
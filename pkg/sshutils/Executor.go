@@ -0,0 +1,151 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package sshutils
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+
+	"github.com/melbahja/goph"
+	"golang.org/x/crypto/ssh"
+)
+
+/*
+Executor runs commands on a server. Steps, uploads, and streams go
+through it, so they can be pointed at something other than a real SSH
+connection in tests. Commands are passed as is, already expanded.
+Cancelling ctx stops whatever is running and returns ctx.Err().
+*/
+type Executor interface {
+	// Run runs command and returns its combined output.
+	Run(ctx context.Context, command string) ([]byte, error)
+
+	// Upload copies upload to remotePath, relative to the home directory.
+	Upload(ctx context.Context, upload FileUpload, remotePath string, debug bool) error
+
+	// Stream runs command with input as its standard input, and returns
+	// its combined output.
+	Stream(ctx context.Context, command string, input io.Reader) ([]byte, error)
+}
+
+/*
+GophExecutor is an Executor for an SSH connection. When ctx is
+cancelled, the command is sent SIGTERM and its session is closed.
+*/
+type GophExecutor struct {
+	Client *goph.Client
+}
+
+func NewGophExecutor(client *goph.Client) *GophExecutor {
+	return &GophExecutor{
+		Client: client,
+	}
+}
+
+func (e *GophExecutor) Run(ctx context.Context, command string) ([]byte, error) {
+	return e.Stream(ctx, command, nil)
+}
+
+func (e *GophExecutor) Upload(ctx context.Context, upload FileUpload, remotePath string, debug bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if upload.Contents != nil {
+		return upload.uploadContents(e.Client, remotePath)
+	}
+
+	return upload.upload(ctx, e, remotePath, debug)
+}
+
+func (e *GophExecutor) Stream(ctx context.Context, command string, input io.Reader) ([]byte, error) {
+	var (
+		err     error
+		session *ssh.Session
+		output  lockedBuffer
+	)
+
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if session, err = e.Client.NewSession(); err != nil {
+		return nil, err
+	}
+
+	defer session.Close()
+
+	session.Stdin = input
+	session.Stdout = &output
+	session.Stderr = &output
+
+	if err = session.Start(command); err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case err = <-done:
+		return output.Bytes(), err
+
+	case <-ctx.Done():
+		_ = session.Signal(ssh.SIGTERM)
+		_ = session.Close()
+		<-done
+
+		return output.Bytes(), ctx.Err()
+	}
+}
+
+func (e *GophExecutor) Close() error {
+	return e.Client.Close()
+}
+
+/*
+lockedBuffer lets a session write stdout and stderr to the same buffer,
+which it does from two goroutines.
+*/
+type lockedBuffer struct {
+	lock   sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.buffer.Write(p)
+}
+
+func (b *lockedBuffer) Bytes() []byte {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return append([]byte{}, b.buffer.Bytes()...)
+}
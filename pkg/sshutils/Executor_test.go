@@ -0,0 +1,153 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package sshutils_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adampresley/pusher/pkg/contextinfo"
+	"github.com/adampresley/pusher/pkg/sshtest"
+	"github.com/adampresley/pusher/pkg/sshutils"
+	"github.com/pterm/pterm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGophExecutor(t *testing.T) {
+	pterm.DisableOutput()
+	defer pterm.EnableOutput()
+
+	server := sshtest.NewServer(t)
+	server.Handler = func(command string, stdin []byte) (string, int) {
+		switch command {
+		case "uname -m":
+			return "x86_64\n", 0
+
+		case "false":
+			return "nope", 1
+
+		default:
+			return string(stdin), 0
+		}
+	}
+
+	executor := sshutils.NewGophExecutor(server.Dial(t))
+	info := contextinfo.ContextInfo{ServiceName: "myapp", User: "pusher"}
+
+	output, err := executor.Run(context.Background(), "uname -m")
+	assert.NoError(t, err)
+	assert.Equal(t, "x86_64\n", string(output))
+
+	output, err = executor.Run(context.Background(), "false")
+	assert.Error(t, err)
+	assert.Equal(t, "nope", string(output))
+
+	output, err = sshutils.Stream(context.Background(), executor, info, "cat > ~/applications/{{.ServiceName}}/input", strings.NewReader("hello"), false)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(output))
+
+	upload := sshutils.FileUpload{
+		Contents:    []byte("SECRET=1\n"),
+		RemotePath:  "applications/{{.ServiceName}}/.env",
+		Description: "Uploading env file",
+	}
+
+	assert.NoError(t, upload.Run(context.Background(), executor, info, false))
+
+	contents, found := server.File("applications/myapp/.env")
+	assert.True(t, found)
+	assert.Equal(t, "SECRET=1\n", string(contents))
+
+	step := sshutils.Step{
+		Commands: []sshutils.Command{
+			sshutils.NewCommand("sudo usermod -aG docker {{.User}}", "Adding user..."),
+			sshutils.NewCommand("false", "Failing..."),
+			sshutils.NewCommand("echo never", "Never run..."),
+		},
+		StartingMessage: "Testing...",
+		ErrorMessage:    "There was a problem: %s",
+	}
+
+	assert.Error(t, step.Run(context.Background(), executor, info, false))
+
+	assert.Equal(t, []string{
+		"uname -m",
+		"false",
+		"cat > ~/applications/myapp/input",
+		"sudo usermod -aG docker pusher",
+		"false",
+	}, server.Commands())
+
+	assert.Equal(t, "hello", string(server.Execs()[2].Stdin))
+}
+
+func TestGophExecutorUploadsLocalFile(t *testing.T) {
+	pterm.DisableOutput()
+	defer pterm.EnableOutput()
+
+	localPath := filepath.Join(t.TempDir(), "myapp-latest.tar")
+	contents := bytes.Repeat([]byte("layer"), 100000)
+	assert.NoError(t, os.WriteFile(localPath, contents, 0644))
+
+	server := sshtest.NewServer(t)
+	server.Handler = func(command string, stdin []byte) (string, int) {
+		uploaded, _ := server.File("applications/myapp/myapp-latest.tar")
+		sum := sha256.Sum256(uploaded)
+
+		return hex.EncodeToString(sum[:]) + "  applications/myapp/myapp-latest.tar\n", 0
+	}
+
+	upload := sshutils.FileUpload{
+		LocalPath:   localPath,
+		RemotePath:  "applications/{{.ServiceName}}/myapp-latest.tar",
+		Description: "Uploading image",
+		Progress:    true,
+		Verify:      true,
+	}
+
+	info := contextinfo.ContextInfo{ServiceName: "myapp"}
+	assert.NoError(t, upload.Run(context.Background(), sshutils.NewGophExecutor(server.Dial(t)), info, false))
+
+	got, found := server.File("applications/myapp/myapp-latest.tar")
+	assert.True(t, found)
+	assert.Equal(t, contents, got)
+	assert.Equal(t, []string{"sha256sum 'applications/myapp/myapp-latest.tar'"}, server.Commands(), "the checksum goes through the executor")
+}
+
+func TestStepDryRunSendsNothing(t *testing.T) {
+	pterm.DisableOutput()
+	defer pterm.EnableOutput()
+
+	recorder := &sshtest.Recorder{}
+	step := sshutils.Step{
+		Commands: []sshutils.Command{sshutils.NewCommand("sudo apt update -y", "Updating...")},
+	}
+
+	assert.NoError(t, step.Run(context.Background(), recorder, contextinfo.ContextInfo{DryRun: true}, false))
+	assert.Empty(t, recorder.Commands())
+}
@@ -0,0 +1,360 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package sshutils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adampresley/pusher/pkg/contextinfo"
+	"github.com/adampresley/pusher/pkg/rendering"
+	"github.com/melbahja/goph"
+	"github.com/pkg/sftp"
+	"github.com/pterm/pterm"
+)
+
+/*
+FileUpload copies a local file to the server over SFTP on an existing
+SSH connection. RemotePath is relative to the user's home directory
+and may use the same template values as a Command. When Contents is
+set it is uploaded instead of LocalPath, so data such as decrypted
+secrets never has to be written to a local file.
+*/
+type FileUpload struct {
+	LocalPath   string
+	RemotePath  string
+	Description string
+	Contents    []byte
+
+	// Progress shows a progress bar with throughput and time remaining.
+	Progress bool
+
+	// Resume continues a previous, partial upload of the same file.
+	Resume bool
+
+	// Verify compares the sha256 checksum of the uploaded file with the local one.
+	Verify bool
+}
+
+func (u FileUpload) Run(ctx context.Context, executor Executor, info contextinfo.ContextInfo, debug bool) error {
+	var (
+		err error
+	)
+
+	remotePath := info.ExpandCommand(u.RemotePath)
+
+	if info.DryRun {
+		rendering.Print("# Upload: %s", u.Description)
+		if u.Contents != nil {
+			rendering.Print("sftp (%d bytes in memory) -> ~/%s", len(u.Contents), remotePath)
+		} else {
+			rendering.Print("sftp %s -> ~/%s", u.LocalPath, remotePath)
+		}
+
+		rendering.BlankLine()
+		return nil
+	}
+
+	if err = executor.Upload(ctx, u, remotePath, debug); err != nil {
+		rendering.Error("%s: %s", u.Description, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (u FileUpload) upload(ctx context.Context, executor *GophExecutor, remotePath string, debug bool) error {
+	var (
+		err         error
+		sftpClient  *sftp.Client
+		localFile   *os.File
+		remoteFile  *sftp.File
+		localInfo   os.FileInfo
+		remoteInfo  os.FileInfo
+		localSum    string
+		offset      int64
+		openFlags   = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		description = u.Description
+	)
+
+	if localFile, err = os.Open(u.LocalPath); err != nil {
+		return fmt.Errorf("Unable to open '%s': %s", u.LocalPath, err.Error())
+	}
+
+	defer localFile.Close()
+
+	if localInfo, err = localFile.Stat(); err != nil {
+		return fmt.Errorf("Unable to read '%s': %s", u.LocalPath, err.Error())
+	}
+
+	if sftpClient, err = executor.Client.NewSftp(); err != nil {
+		return fmt.Errorf("Unable to start an SFTP session: %s", err.Error())
+	}
+
+	defer sftpClient.Close()
+
+	if u.Verify || u.Resume {
+		if localSum, err = fileChecksum(localFile, localInfo.Size()); err != nil {
+			return err
+		}
+	}
+
+	/*
+	 * Pick up where a previous upload left off, as long as what is
+	 * already on the server matches the start of the local file.
+	 */
+	if u.Resume {
+		if remoteInfo, err = sftpClient.Stat(remotePath); err == nil && remoteInfo.Size() > 0 && remoteInfo.Size() <= localInfo.Size() {
+			var localPartial, remotePartial string
+
+			if localPartial, err = fileChecksum(localFile, remoteInfo.Size()); err != nil {
+				return err
+			}
+
+			remotePartial, _ = remoteChecksum(ctx, executor, remotePath, remoteInfo.Size())
+
+			if localPartial == remotePartial {
+				offset = remoteInfo.Size()
+				openFlags = os.O_WRONLY
+
+				if debug {
+					rendering.Print("Resuming upload of '%s' at %d bytes", u.LocalPath, offset)
+				}
+			}
+		}
+	}
+
+	if offset < localInfo.Size() || localInfo.Size() == 0 {
+		if remoteFile, err = sftpClient.OpenFile(remotePath, openFlags); err != nil {
+			return fmt.Errorf("Unable to create '%s' on the server: %s", remotePath, err.Error())
+		}
+
+		defer remoteFile.Close()
+
+		if _, err = localFile.Seek(offset, io.SeekStart); err != nil {
+			return fmt.Errorf("Unable to read '%s': %s", u.LocalPath, err.Error())
+		}
+
+		if _, err = remoteFile.Seek(offset, io.SeekStart); err != nil {
+			return fmt.Errorf("Unable to resume '%s' on the server: %s", remotePath, err.Error())
+		}
+
+		/*
+		 * Progress is counted as the file is read, so the upload still
+		 * goes through ReadFrom, which keeps several writes in flight.
+		 */
+		reader := contextFile{ctx: ctx, file: localFile}
+
+		if u.Progress {
+			reader.progress = newUploadProgress(description, offset, localInfo.Size())
+			defer reader.progress.stop()
+		}
+
+		if _, err = remoteFile.ReadFrom(reader); err != nil {
+			return fmt.Errorf("Unable to upload '%s': %s", u.LocalPath, err.Error())
+		}
+
+		if err = remoteFile.Close(); err != nil {
+			return fmt.Errorf("Unable to upload '%s': %s", u.LocalPath, err.Error())
+		}
+	}
+
+	if u.Verify {
+		var uploadedSum string
+
+		if uploadedSum, err = remoteChecksum(ctx, executor, remotePath, -1); err != nil {
+			return err
+		}
+
+		if uploadedSum != localSum {
+			_ = sftpClient.Remove(remotePath)
+			return fmt.Errorf("The checksum of '%s' on the server does not match the local file. Please deploy again", remotePath)
+		}
+	}
+
+	return nil
+}
+
+/*
+uploadContents writes Contents to the server. The file is only readable
+by its owner.
+*/
+func (u FileUpload) uploadContents(sshClient *goph.Client, remotePath string) error {
+	var (
+		err        error
+		sftpClient *sftp.Client
+		remoteFile *sftp.File
+	)
+
+	if sftpClient, err = sshClient.NewSftp(); err != nil {
+		return fmt.Errorf("Unable to start an SFTP session: %s", err.Error())
+	}
+
+	defer sftpClient.Close()
+
+	if remoteFile, err = sftpClient.OpenFile(remotePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC); err != nil {
+		return fmt.Errorf("Unable to create '%s' on the server: %s", remotePath, err.Error())
+	}
+
+	defer remoteFile.Close()
+
+	if err = remoteFile.Chmod(0600); err != nil {
+		return fmt.Errorf("Unable to set permissions on '%s': %s", remotePath, err.Error())
+	}
+
+	if _, err = remoteFile.Write(u.Contents); err != nil {
+		return fmt.Errorf("Unable to upload '%s': %s", remotePath, err.Error())
+	}
+
+	return remoteFile.Close()
+}
+
+/*
+fileChecksum returns the sha256 of the first length bytes of a file.
+*/
+func fileChecksum(f *os.File, length int64) (string, error) {
+	hash := sha256.New()
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("Unable to read '%s': %s", f.Name(), err.Error())
+	}
+
+	if _, err := io.CopyN(hash, f, length); err != nil && err != io.EOF {
+		return "", fmt.Errorf("Unable to read '%s': %s", f.Name(), err.Error())
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+/*
+remoteChecksum returns the sha256 of the first length bytes of a file on
+the server, or of the whole file when length is negative.
+*/
+func remoteChecksum(ctx context.Context, executor Executor, remotePath string, length int64) (string, error) {
+	command := "sha256sum " + contextinfo.ShellQuote(remotePath)
+
+	if length >= 0 {
+		command = "head -c " + strconv.FormatInt(length, 10) + " " + contextinfo.ShellQuote(remotePath) + " | sha256sum"
+	}
+
+	b, err := executor.Run(ctx, command)
+
+	if err != nil {
+		return "", fmt.Errorf("Unable to verify '%s' on the server: %s", remotePath, err.Error())
+	}
+
+	return strings.Fields(string(b) + " ")[0], nil
+}
+
+/*
+contextFile reads a file for an upload. It stops the upload when ctx is
+cancelled and moves progress along, when set. Stat lets SFTP see the
+size of the file and keep several writes in flight.
+*/
+type contextFile struct {
+	ctx      context.Context
+	file     *os.File
+	progress *uploadProgress
+}
+
+func (f contextFile) Read(p []byte) (int, error) {
+	if err := f.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := f.file.Read(p)
+
+	if f.progress != nil && n > 0 {
+		_, _ = f.progress.Write(p[:n])
+	}
+
+	return n, err
+}
+
+func (f contextFile) Stat() (os.FileInfo, error) {
+	return f.file.Stat()
+}
+
+/*
+uploadProgress is an io.Writer that moves a progress bar along and shows
+the upload speed and time remaining in its title.
+*/
+type uploadProgress struct {
+	bar         *pterm.ProgressbarPrinter
+	description string
+	started     time.Time
+	lastUpdate  time.Time
+	sent        int64
+	remaining   int64
+	scale       int64
+}
+
+func newUploadProgress(description string, offset, total int64) *uploadProgress {
+	/*
+	 * The progress bar counts in ints, so count kilobytes.
+	 */
+	result := &uploadProgress{
+		description: description,
+		started:     time.Now(),
+		remaining:   total - offset,
+		scale:       1024,
+	}
+
+	result.bar = rendering.ProgressBar(description, int(total/result.scale)+1)
+	result.bar.Add(int(offset / result.scale))
+
+	return result
+}
+
+func (p *uploadProgress) Write(b []byte) (int, error) {
+	before := p.sent / p.scale
+	p.sent += int64(len(b))
+
+	p.bar.Add(int(p.sent/p.scale - before))
+
+	if time.Since(p.lastUpdate) > 500*time.Millisecond {
+		p.lastUpdate = time.Now()
+		elapsed := time.Since(p.started).Seconds()
+		rate := float64(p.sent) / elapsed
+
+		eta := time.Duration(0)
+
+		if rate > 0 {
+			eta = time.Duration(float64(p.remaining-p.sent)/rate) * time.Second
+		}
+
+		p.bar.UpdateTitle(fmt.Sprintf("%s (%.1f MB/s, %s left)", p.description, rate/1024/1024, eta.Round(time.Second)))
+	}
+
+	return len(b), nil
+}
+
+func (p *uploadProgress) stop() {
+	_, _ = p.bar.Stop()
+}
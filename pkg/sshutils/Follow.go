@@ -0,0 +1,95 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package sshutils
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"github.com/adampresley/pusher/pkg/contextinfo"
+	"github.com/adampresley/pusher/pkg/rendering"
+	"github.com/melbahja/goph"
+	"golang.org/x/crypto/ssh"
+)
+
+/*
+Follow runs a command on the server and copies its output to the
+terminal as it arrives, until the command exits or ctx is cancelled,
+as it is when the user presses Ctrl-C. Unlike a Step, command is not a template and runs as is.
+
+Without a terminal, closing the SSH session doesn't stop the command on
+the server, so it runs in its own process group alongside a watcher that
+kills the group once our side of stdin closes.
+*/
+func Follow(ctx context.Context, sshClient *goph.Client, info contextinfo.ContextInfo, command string, debug bool) error {
+	var (
+		err     error
+		session *ssh.Session
+		stdin   io.WriteCloser
+	)
+
+	wrapped := "setsid sh -c " + contextinfo.ShellQuote(command) + " & p=$!; (cat >/dev/null; kill -TERM -$p 2>/dev/null) >/dev/null 2>&1 & wait $p"
+
+	if debug {
+		rendering.Print("COMMAND: %s", command)
+	}
+
+	if session, err = sshClient.NewSession(); err != nil {
+		return err
+	}
+
+	defer session.Close()
+
+	if stdin, err = session.StdinPipe(); err != nil {
+		return err
+	}
+
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+
+	if err = session.Start(wrapped); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case err = <-done:
+		return err
+
+	case <-ctx.Done():
+		_ = stdin.Close()
+
+		select {
+		case <-done:
+		case <-time.After(3 * time.Second):
+		}
+
+		return nil
+	}
+}
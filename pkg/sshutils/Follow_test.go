@@ -0,0 +1,67 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package sshutils_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adampresley/pusher/pkg/contextinfo"
+	"github.com/adampresley/pusher/pkg/sshtest"
+	"github.com/adampresley/pusher/pkg/sshutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFollowStopsWhenCancelled(t *testing.T) {
+	server := sshtest.NewServer(t)
+	client := server.Dial(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- sshutils.Follow(ctx, client, contextinfo.ContextInfo{}, "sudo docker logs -f myapp", false)
+	}()
+
+	/*
+	 * The test server only runs a command once its stdin closes, which
+	 * Follow does when it is cancelled.
+	 */
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, server.Commands())
+
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("Follow didn't return after being cancelled")
+	}
+
+	commands := server.Commands()
+	assert.Len(t, commands, 1)
+	assert.True(t, strings.HasPrefix(commands[0], "setsid sh -c 'sudo docker logs -f myapp' & "))
+}
@@ -0,0 +1,386 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package sshutils
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adampresley/pusher/pkg/parsing"
+	"github.com/adampresley/pusher/pkg/rendering"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+/*
+Values of StrictHostKeyChecking. "ask" is the default.
+*/
+const (
+	StrictHostKeyCheckingYes       string = "yes"
+	StrictHostKeyCheckingAcceptNew string = "accept-new"
+	StrictHostKeyCheckingNo        string = "no"
+	StrictHostKeyCheckingAsk       string = "ask"
+)
+
+var (
+	defaultUserKnownHostsFiles   = []string{"~/.ssh/known_hosts", "~/.ssh/known_hosts2"}
+	defaultGlobalKnownHostsFiles = []string{"/etc/ssh/ssh_known_hosts", "/etc/ssh/ssh_known_hosts2"}
+)
+
+/*
+HostKeyPrompt asks whether to trust a host seen for the first time. It
+returns true to trust it.
+*/
+type HostKeyPrompt func(host string, key ssh.PublicKey) (bool, error)
+
+/*
+HostKeyChecker verifies host keys against known_hosts files, following
+OpenSSH's StrictHostKeyChecking:
+
+  - yes: only hosts already in a known_hosts file are accepted.
+  - accept-new: unknown hosts are added without asking.
+  - no: the same as accept-new.
+  - ask: Prompt is asked about unknown hosts. Without a Prompt, they are
+    refused.
+
+A host whose key doesn't match the one on file is always refused, as it
+may mean someone is intercepting the connection.
+*/
+type HostKeyChecker struct {
+	// UserKnownHostsFiles are read, and the first one is where new hosts
+	// are written.
+	UserKnownHostsFiles   []string
+	GlobalKnownHostsFiles []string
+
+	StrictHostKeyChecking string
+	HashKnownHosts        bool
+
+	// HostKeyAlias, when set, is the name looked up instead of the host.
+	HostKeyAlias string
+
+	Prompt HostKeyPrompt
+}
+
+/*
+UnknownHostKeyError is returned for a host that isn't in any known_hosts
+file and couldn't be trusted.
+*/
+type UnknownHostKeyError struct {
+	Host   string
+	Key    ssh.PublicKey
+	Reason string
+}
+
+func (e *UnknownHostKeyError) Error() string {
+	return fmt.Sprintf("The authenticity of host '%s' can't be established (%s key fingerprint %s). %s",
+		e.Host, e.Key.Type(), ssh.FingerprintSHA256(e.Key), e.Reason)
+}
+
+/*
+HostKeyChangedError is returned when a host's key doesn't match the one in
+a known_hosts file.
+*/
+type HostKeyChangedError struct {
+	Host  string
+	Key   ssh.PublicKey
+	Known []knownhosts.KnownKey
+}
+
+func (e *HostKeyChangedError) Error() string {
+	result := strings.Builder{}
+
+	result.WriteString(fmt.Sprintf("WARNING: THE HOST KEY FOR '%s' HAS CHANGED! ", e.Host))
+	result.WriteString("Someone could be eavesdropping on you right now (a man-in-the-middle attack), or the server's key was replaced. ")
+	result.WriteString(fmt.Sprintf("The server sent a %s key with fingerprint %s, which doesn't match ", e.Key.Type(), ssh.FingerprintSHA256(e.Key)))
+
+	for i, known := range e.Known {
+		if i > 0 {
+			result.WriteString(", ")
+		}
+
+		result.WriteString(fmt.Sprintf("%s:%d", known.Filename, known.Line))
+	}
+
+	result.WriteString(". If the change is expected, remove the old key with 'ssh-keygen -R' and connect again.")
+	return result.String()
+}
+
+/*
+NewHostKeyChecker builds a checker from the SSH config for host. prompt
+may be nil.
+*/
+func NewHostKeyChecker(host parsing.SSHHost, prompt HostKeyPrompt) HostKeyChecker {
+	return HostKeyChecker{
+		UserKnownHostsFiles:   knownHostsFiles(host.Option("UserKnownHostsFile"), defaultUserKnownHostsFiles),
+		GlobalKnownHostsFiles: knownHostsFiles(host.Option("GlobalKnownHostsFile"), defaultGlobalKnownHostsFiles),
+		StrictHostKeyChecking: host.Option("StrictHostKeyChecking"),
+		HashKnownHosts:        strings.EqualFold(host.Option("HashKnownHosts"), "yes"),
+		HostKeyAlias:          host.Option("HostKeyAlias"),
+		Prompt:                prompt,
+	}
+}
+
+func knownHostsFiles(value string, defaults []string) []string {
+	result := []string{}
+
+	if strings.EqualFold(value, "none") {
+		return result
+	}
+
+	fileNames := strings.Fields(value)
+
+	if len(fileNames) == 0 {
+		fileNames = defaults
+	}
+
+	for _, fileName := range fileNames {
+		result = append(result, parsing.ExpandHomeDir(fileName))
+	}
+
+	return result
+}
+
+/*
+Callback returns the checker as an ssh.HostKeyCallback.
+*/
+func (c HostKeyChecker) Callback() ssh.HostKeyCallback {
+	return c.Check
+}
+
+/*
+Check verifies key for hostname, which is the host:port being dialed.
+*/
+func (c HostKeyChecker) Check(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	var (
+		err      error
+		keyErr   *knownhosts.KeyError
+		revoked  *knownhosts.RevokedError
+		callback ssh.HostKeyCallback
+		trusted  bool
+	)
+
+	hostname = c.lookupName(hostname)
+
+	if callback, err = c.knownHosts(); err != nil {
+		return err
+	}
+
+	err = callback(hostname, remote, key)
+
+	switch {
+	case err == nil:
+		return nil
+
+	case errors.As(err, &revoked):
+		return fmt.Errorf("The host key for '%s' has been revoked: %s", hostname, err.Error())
+
+	case !errors.As(err, &keyErr):
+		return err
+
+	case len(keyErr.Want) > 0:
+		return &HostKeyChangedError{Host: hostname, Key: key, Known: keyErr.Want}
+	}
+
+	switch c.strictness() {
+	case StrictHostKeyCheckingYes:
+		return &UnknownHostKeyError{Host: hostname, Key: key, Reason: "StrictHostKeyChecking is on, so add it to known_hosts first."}
+
+	case StrictHostKeyCheckingAsk:
+		if c.Prompt == nil {
+			return &UnknownHostKeyError{Host: hostname, Key: key, Reason: "Run 'pusher prepare', or connect with ssh once, to review and trust it."}
+		}
+
+		if trusted, err = c.Prompt(hostname, key); err != nil {
+			return err
+		}
+
+		if !trusted {
+			return &UnknownHostKeyError{Host: hostname, Key: key, Reason: "Host key verification failed."}
+		}
+	}
+
+	return c.add(hostname, key)
+}
+
+/*
+Algorithms returns the host key algorithms of the keys already known for
+hostname, so the server is asked for one of those rather than a type
+we've never seen from it. It returns nil for unknown hosts.
+*/
+func (c HostKeyChecker) Algorithms(hostname string) []string {
+	var (
+		err      error
+		keyErr   *knownhosts.KeyError
+		callback ssh.HostKeyCallback
+	)
+
+	if callback, err = c.knownHosts(); err != nil {
+		return nil
+	}
+
+	/*
+	 * knownhosts has no lookup, but a key that can't match makes it
+	 * list every key it has for the host.
+	 */
+	probe, _ := ssh.NewPublicKey(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)))
+	err = callback(c.lookupName(hostname), &net.TCPAddr{}, probe)
+
+	if !errors.As(err, &keyErr) {
+		return nil
+	}
+
+	result := []string{}
+
+	for _, known := range keyErr.Want {
+		for _, algorithm := range algorithmsForKeyType(known.Key.Type()) {
+			if !containsString(result, algorithm) {
+				result = append(result, algorithm)
+			}
+		}
+	}
+
+	if len(result) == 0 {
+		return nil
+	}
+
+	return result
+}
+
+func algorithmsForKeyType(keyType string) []string {
+	switch keyType {
+	case ssh.KeyAlgoRSA:
+		return []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+
+	case ssh.CertAlgoRSAv01:
+		return []string{ssh.CertAlgoRSASHA512v01, ssh.CertAlgoRSASHA256v01, ssh.CertAlgoRSAv01}
+
+	default:
+		return []string{keyType}
+	}
+}
+
+func (c HostKeyChecker) strictness() string {
+	switch strings.ToLower(c.StrictHostKeyChecking) {
+	case "yes", "true":
+		return StrictHostKeyCheckingYes
+
+	case "accept-new":
+		return StrictHostKeyCheckingAcceptNew
+
+	case "no", "off", "false":
+		return StrictHostKeyCheckingNo
+
+	default:
+		return StrictHostKeyCheckingAsk
+	}
+}
+
+func (c HostKeyChecker) lookupName(hostname string) string {
+	if c.HostKeyAlias == "" {
+		return hostname
+	}
+
+	if _, port, err := net.SplitHostPort(hostname); err == nil {
+		return net.JoinHostPort(c.HostKeyAlias, port)
+	}
+
+	return c.HostKeyAlias
+}
+
+/*
+knownHosts reads the known_hosts files that exist. They are read on each
+check so hosts added by an earlier connection are seen.
+*/
+func (c HostKeyChecker) knownHosts() (ssh.HostKeyCallback, error) {
+	fileNames := []string{}
+
+	for _, fileName := range append(append([]string{}, c.UserKnownHostsFiles...), c.GlobalKnownHostsFiles...) {
+		if _, err := os.Stat(fileName); err == nil {
+			fileNames = append(fileNames, fileName)
+		}
+	}
+
+	callback, err := knownhosts.New(fileNames...)
+
+	if err != nil {
+		return nil, fmt.Errorf("There was a problem reading your known_hosts files: %s", err.Error())
+	}
+
+	return callback, nil
+}
+
+/*
+add appends key to the first UserKnownHostsFile, and says so once it is
+written. Without one, the key is trusted for this connection only.
+*/
+func (c HostKeyChecker) add(hostname string, key ssh.PublicKey) error {
+	var (
+		err error
+		f   *os.File
+	)
+
+	if len(c.UserKnownHostsFiles) == 0 {
+		return nil
+	}
+
+	fileName := c.UserKnownHostsFiles[0]
+	address := knownhosts.Normalize(hostname)
+
+	if c.HashKnownHosts {
+		address = knownhosts.HashHostname(address)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(fileName), 0700); err != nil {
+		return fmt.Errorf("There was a problem creating '%s': %s", filepath.Dir(fileName), err.Error())
+	}
+
+	if f, err = os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err != nil {
+		return fmt.Errorf("There was a problem opening '%s': %s", fileName, err.Error())
+	}
+
+	if _, err = fmt.Fprintln(f, knownhosts.Line([]string{address}, key)); err != nil {
+		f.Close()
+		return fmt.Errorf("There was a problem writing to '%s': %s", fileName, err.Error())
+	}
+
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("There was a problem writing to '%s': %s", fileName, err.Error())
+	}
+
+	rendering.Warning("Permanently added '%s' (%s) to the list of known hosts.", hostname, key.Type())
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
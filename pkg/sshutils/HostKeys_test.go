@@ -0,0 +1,349 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package sshutils_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adampresley/pusher/pkg/sshutils"
+	"github.com/pterm/pterm"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestHostKeyChecker(t *testing.T) {
+	hostKey := newEd25519Signer(t)
+	otherKey := newEd25519Signer(t)
+	address := startServer(t, hostKey)
+
+	tests := []struct {
+		name       string
+		known      []ssh.PublicKey
+		strict     string
+		prompt     sshutils.HostKeyPrompt
+		wantErr    any
+		wantPrompt bool
+		wantAdded  bool
+	}{
+		{
+			name:   "known host connects",
+			known:  []ssh.PublicKey{hostKey.PublicKey()},
+			strict: "yes",
+		},
+		{
+			name:    "unknown host is refused when strict",
+			strict:  "yes",
+			wantErr: &sshutils.UnknownHostKeyError{},
+		},
+		{
+			name:      "unknown host is added with accept-new",
+			strict:    "accept-new",
+			wantAdded: true,
+		},
+		{
+			name:      "unknown host is added with no",
+			strict:    "no",
+			wantAdded: true,
+		},
+		{
+			name:    "unknown host is refused when there is no one to ask",
+			wantErr: &sshutils.UnknownHostKeyError{},
+		},
+		{
+			name:       "unknown host is added when trusted",
+			strict:     "ask",
+			prompt:     func(string, ssh.PublicKey) (bool, error) { return true, nil },
+			wantPrompt: true,
+			wantAdded:  true,
+		},
+		{
+			name:       "unknown host is refused when not trusted",
+			prompt:     func(string, ssh.PublicKey) (bool, error) { return false, nil },
+			wantPrompt: true,
+			wantErr:    &sshutils.UnknownHostKeyError{},
+		},
+		{
+			name:    "changed key is refused even when checking is off",
+			known:   []ssh.PublicKey{otherKey.PublicKey()},
+			strict:  "no",
+			prompt:  func(string, ssh.PublicKey) (bool, error) { return true, nil },
+			wantErr: &sshutils.HostKeyChangedError{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prompted := false
+			knownHostsFile := writeKnownHosts(t, address, tt.known...)
+
+			checker := sshutils.HostKeyChecker{
+				UserKnownHostsFiles:   []string{knownHostsFile},
+				StrictHostKeyChecking: tt.strict,
+			}
+
+			if tt.prompt != nil {
+				checker.Prompt = func(host string, key ssh.PublicKey) (bool, error) {
+					prompted = true
+					assert.Equal(t, ssh.FingerprintSHA256(hostKey.PublicKey()), ssh.FingerprintSHA256(key))
+					return tt.prompt(host, key)
+				}
+			}
+
+			err := connect(checker, address)
+
+			switch want := tt.wantErr.(type) {
+			case *sshutils.UnknownHostKeyError:
+				assert.True(t, errors.As(err, &want), "got %v", err)
+
+			case *sshutils.HostKeyChangedError:
+				assert.True(t, errors.As(err, &want), "got %v", err)
+				assert.Contains(t, err.Error(), "man-in-the-middle")
+
+			default:
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.wantPrompt, prompted)
+
+			wantLines := len(tt.known)
+
+			if tt.wantAdded {
+				wantLines++
+			}
+
+			contents, _ := os.ReadFile(knownHostsFile)
+			assert.Equal(t, wantLines, strings.Count(string(contents), "\n"))
+
+			if tt.wantAdded {
+				checker.StrictHostKeyChecking = "yes"
+				assert.NoError(t, connect(checker, address), "a host added once is known afterwards")
+			}
+		})
+	}
+}
+
+func TestHostKeyCheckerHashesNewHosts(t *testing.T) {
+	hostKey := newEd25519Signer(t)
+	address := startServer(t, hostKey)
+	knownHostsFile := writeKnownHosts(t, address)
+
+	checker := sshutils.HostKeyChecker{
+		UserKnownHostsFiles:   []string{knownHostsFile},
+		StrictHostKeyChecking: "accept-new",
+		HashKnownHosts:        true,
+	}
+
+	assert.NoError(t, connect(checker, address))
+
+	contents, _ := os.ReadFile(knownHostsFile)
+	assert.True(t, strings.HasPrefix(string(contents), "|1|"))
+	assert.NotContains(t, string(contents), "127.0.0.1")
+
+	checker.StrictHostKeyChecking = "yes"
+	assert.NoError(t, connect(checker, address))
+}
+
+func TestHostKeyCheckerReportsAddedHosts(t *testing.T) {
+	hostKey := newEd25519Signer(t)
+	address := startServer(t, hostKey)
+
+	notADirectory := filepath.Join(t.TempDir(), "file")
+	assert.NoError(t, os.WriteFile(notADirectory, nil, 0600))
+
+	tests := []struct {
+		name           string
+		knownHostsFile string
+		wantErr        bool
+		wantMessage    bool
+	}{
+		{
+			name:           "written to known_hosts",
+			knownHostsFile: filepath.Join(t.TempDir(), "known_hosts"),
+			wantMessage:    true,
+		},
+		{
+			name: "no known_hosts file to write to",
+		},
+		{
+			name:           "known_hosts can't be written",
+			knownHostsFile: filepath.Join(notADirectory, "known_hosts"),
+			wantErr:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			pterm.SetDefaultOutput(output)
+			defer pterm.SetDefaultOutput(os.Stdout)
+
+			checker := sshutils.HostKeyChecker{StrictHostKeyChecking: "accept-new"}
+
+			if tt.knownHostsFile != "" {
+				checker.UserKnownHostsFiles = []string{tt.knownHostsFile}
+			}
+
+			err := connect(checker, address)
+			assert.Equal(t, tt.wantErr, err != nil, "got %v", err)
+			assert.Equal(t, tt.wantMessage, strings.Contains(output.String(), "Permanently added"))
+		})
+	}
+}
+
+func TestHostKeyCheckerAsksForKnownKeyType(t *testing.T) {
+	ed25519Key := newEd25519Signer(t)
+	ecdsaKey := newECDSASigner(t)
+	address := startServer(t, ed25519Key, ecdsaKey)
+
+	checker := sshutils.HostKeyChecker{
+		UserKnownHostsFiles:   []string{writeKnownHosts(t, address, ecdsaKey.PublicKey())},
+		StrictHostKeyChecking: "yes",
+	}
+
+	assert.Equal(t, []string{ssh.KeyAlgoECDSA256}, checker.Algorithms(address))
+	assert.NoError(t, connect(checker, address))
+}
+
+func TestHostKeyCheckerUsesHostKeyAlias(t *testing.T) {
+	hostKey := newEd25519Signer(t)
+	address := startServer(t, hostKey)
+	_, port, _ := net.SplitHostPort(address)
+
+	checker := sshutils.HostKeyChecker{
+		UserKnownHostsFiles:   []string{writeKnownHosts(t, net.JoinHostPort("server.example.com", port), hostKey.PublicKey())},
+		StrictHostKeyChecking: "yes",
+		HostKeyAlias:          "server.example.com",
+	}
+
+	assert.NoError(t, connect(checker, address))
+}
+
+func connect(checker sshutils.HostKeyChecker, address string) error {
+	client, err := ssh.Dial("tcp", address, &ssh.ClientConfig{
+		User:              "pusher",
+		HostKeyCallback:   checker.Callback(),
+		HostKeyAlgorithms: checker.Algorithms(address),
+		Timeout:           5 * time.Second,
+	})
+
+	if err == nil {
+		client.Close()
+	}
+
+	return err
+}
+
+/*
+startServer runs an SSH server that lets anyone in and refuses every
+channel, which is enough to exercise the handshake.
+*/
+func startServer(t *testing.T, hostKeys ...ssh.Signer) string {
+	config := &ssh.ServerConfig{NoClientAuth: true}
+
+	for _, hostKey := range hostKeys {
+		config.AddHostKey(hostKey)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go func() {
+				_, channels, requests, err := ssh.NewServerConn(conn, config)
+
+				if err != nil {
+					conn.Close()
+					return
+				}
+
+				go ssh.DiscardRequests(requests)
+
+				for channel := range channels {
+					_ = channel.Reject(ssh.Prohibited, "no channels")
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func writeKnownHosts(t *testing.T, address string, keys ...ssh.PublicKey) string {
+	fileName := filepath.Join(t.TempDir(), "known_hosts")
+	lines := ""
+
+	for _, key := range keys {
+		lines += knownhosts.Line([]string{knownhosts.Normalize(address)}, key) + "\n"
+	}
+
+	if err := os.WriteFile(fileName, []byte(lines), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return fileName
+}
+
+func newEd25519Signer(t *testing.T) ssh.Signer {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	signer, err := ssh.NewSignerFromKey(key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signer
+}
+
+func newECDSASigner(t *testing.T) ssh.Signer {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	signer, err := ssh.NewSignerFromKey(key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signer
+}
@@ -0,0 +1,114 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package sshutils
+
+import (
+	"context"
+	"os"
+
+	"github.com/adampresley/pusher/pkg/contextinfo"
+	"github.com/adampresley/pusher/pkg/rendering"
+	"github.com/melbahja/goph"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+/*
+Interactive runs a command on the server in a pseudo terminal connected
+to ours, for things like shells and REPLs. Our terminal is put in raw
+mode for the duration, so keys such as Ctrl-C go to the remote program,
+and size changes are passed along. Like Follow, command runs as is, and
+the session is closed when ctx is cancelled.
+*/
+func Interactive(ctx context.Context, sshClient *goph.Client, info contextinfo.ContextInfo, command string, debug bool) error {
+	var (
+		err     error
+		session *ssh.Session
+		state   *term.State
+	)
+
+	if debug {
+		rendering.Print("COMMAND: %s", command)
+	}
+
+	if session, err = sshClient.NewSession(); err != nil {
+		return err
+	}
+
+	defer session.Close()
+
+	fd := int(os.Stdin.Fd())
+	width, height := 80, 24
+
+	if term.IsTerminal(fd) {
+		if width, height, err = term.GetSize(fd); err != nil {
+			width, height = 80, 24
+		}
+
+		if state, err = term.MakeRaw(fd); err != nil {
+			return err
+		}
+
+		defer term.Restore(fd, state)
+	}
+
+	termType := os.Getenv("TERM")
+
+	if termType == "" {
+		termType = "xterm-256color"
+	}
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+
+	if err = session.RequestPty(termType, height, width, modes); err != nil {
+		return err
+	}
+
+	session.Stdin = os.Stdin
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+
+	if err = session.Start(command); err != nil {
+		return err
+	}
+
+	stopResizing := forwardWindowSize(session, fd)
+	defer stopResizing()
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case err = <-done:
+		return err
+
+	case <-ctx.Done():
+		return nil
+	}
+}
@@ -23,110 +23,302 @@ package sshutils
 
 import (
 	"fmt"
-	"io/fs"
+	"os"
 	"strconv"
 	"strings"
 
 	"github.com/adampresley/pusher/pkg/contextinfo"
 	"github.com/adampresley/pusher/pkg/parsing"
 	"github.com/adampresley/pusher/pkg/project"
-	"github.com/kevinburke/ssh_config"
 	"github.com/melbahja/goph"
+	"golang.org/x/crypto/ssh"
 )
 
-func getClient(hostKey string) (*goph.Client, contextinfo.ContextInfo, error) {
+func getHostInfo(hostKey string) (contextinfo.ContextInfo, error) {
+	_, info, err := resolveHost(hostKey)
+	return info, err
+}
+
+/*
+resolveHost reads the SSH config for hostKey and returns it along with
+the values the rest of pusher uses.
+*/
+func resolveHost(hostKey string) (parsing.SSHHost, contextinfo.ContextInfo, error) {
 	var (
-		err      error
-		f        fs.File
-		hostInfo *ssh_config.Host
-		auth     goph.Auth
-		result   *goph.Client
+		err  error
+		host parsing.SSHHost
+	)
+
+	sshInfo := contextinfo.ContextInfo{}
+
+	if host, err = parsing.ResolveSSHHost(hostKey); err != nil {
+		return host, sshInfo, fmt.Errorf("There was a problem reading your SSH config: %s", err.Error())
+	}
+
+	if len(host.IdentityFiles) == 0 {
+		host.IdentityFiles = defaultIdentityFiles()
+	}
+
+	sshInfo.HostName = host.HostName
+	sshInfo.User = host.User
+
+	if len(host.IdentityFiles) > 0 {
+		sshInfo.IdentityFile = host.IdentityFiles[0]
+	}
+
+	/*
+	 * Validate
+	 */
+	if sshInfo.User == "" {
+		return host, sshInfo, fmt.Errorf("'User' not found in your SSH config for '%s'", hostKey)
+	}
+
+	if sshInfo.IdentityFile == "" && agentSocket(host) == "" {
+		return host, sshInfo, fmt.Errorf("'IdentityFile' not found in your SSH config for '%s', and ssh-agent isn't running", hostKey)
+	}
+
+	return host, sshInfo, nil
+}
+
+/*
+defaultIdentityFiles returns the keys OpenSSH tries when the config
+doesn't name any, if they exist.
+*/
+func defaultIdentityFiles() []string {
+	result := []string{}
+
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		fileName := parsing.ExpandHomeDir("~/.ssh/" + name)
+
+		if _, err := os.Stat(fileName); err == nil {
+			result = append(result, fileName)
+		}
+	}
+
+	return result
+}
+
+func getClient(hostKey string, prompt HostKeyPrompt) (*goph.Client, contextinfo.ContextInfo, error) {
+	var (
+		err    error
+		host   parsing.SSHHost
+		result *goph.Client
 
 		sshInfo contextinfo.ContextInfo
 	)
 
-	if f, err = parsing.OpenSSHConfigFile(parsing.DefaultSSHConfigFile); err != nil {
+	if host, sshInfo, err = resolveHost(hostKey); err != nil {
 		return result, sshInfo, err
 	}
 
-	if hostInfo, err = parsing.GetSSHHost(f, hostKey); err != nil {
-		return result, sshInfo, err
+	if result, err = dialHost(host, prompt); err != nil {
+		return result, sshInfo, fmt.Errorf("There was a problem setting up an SSH client to '%s' (user '%s'): %s", host.Address(), host.User, err.Error())
 	}
 
-	sshInfo = contextinfo.ContextInfo{}
+	return result, sshInfo, nil
+}
 
-	for _, n := range hostInfo.Nodes {
-		line := strings.TrimSpace(n.String())
-		lowerLine := strings.ToLower(line)
+/*
+dialHost connects to host, going through each of its ProxyJump hosts in
+turn. Jump hosts are looked up in the SSH config like any other host.
+*/
+func dialHost(host parsing.SSHHost, prompt HostKeyPrompt) (*goph.Client, error) {
+	var (
+		err      error
+		previous *ssh.Client
+		client   *ssh.Client
+		config   *ssh.ClientConfig
+	)
 
-		if !n.Pos().Invalid() && line != "" {
-			if strings.HasPrefix(lowerLine, "hostname") {
-				if sshInfo.HostName, err = getValue(line); err != nil {
-					return result, sshInfo, err
-				}
-			}
+	hops := []parsing.SSHHost{}
 
-			if strings.HasPrefix(lowerLine, "user") {
-				if sshInfo.User, err = getValue(line); err != nil {
-					return result, sshInfo, err
-				}
-			}
+	for _, jump := range host.ProxyJump {
+		var hop parsing.SSHHost
 
-			if strings.HasPrefix(lowerLine, "identityfile") {
-				if sshInfo.IdentityFile, err = getValue(line); err != nil {
-					return result, sshInfo, err
-				}
+		if hop, err = resolveJumpHost(jump); err != nil {
+			return nil, err
+		}
 
-				sshInfo.IdentityFile = parsing.ExpandHomeDir(sshInfo.IdentityFile)
-			}
+		hops = append(hops, hop)
+	}
+
+	hops = append(hops, host)
+
+	for _, hop := range hops {
+		if config, err = clientConfig(hop, prompt); err != nil {
+			return nil, err
 		}
+
+		if previous == nil {
+			client, err = ssh.Dial("tcp", hop.Address(), config)
+		} else {
+			client, err = dialThrough(previous, hop.Address(), config)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("Unable to connect to '%s': %s", hop.Address(), err.Error())
+		}
+
+		/*
+		 * Close each jump host once the connection through it is done.
+		 */
+		if previous != nil {
+			go func(jump, through *ssh.Client) {
+				_ = through.Wait()
+				_ = jump.Close()
+			}(previous, client)
+		}
+
+		previous = client
 	}
 
-	/*
-	 * Validate
-	 */
-	if sshInfo.HostName == "" {
-		return result, sshInfo, fmt.Errorf("'HostName' not found in your SSH config for '%s'", hostKey)
+	return &goph.Client{
+		Client: client,
+		Config: &goph.Config{
+			User:     host.User,
+			Addr:     host.HostName,
+			Port:     uint(host.Port),
+			Auth:     config.Auth,
+			Timeout:  config.Timeout,
+			Callback: config.HostKeyCallback,
+		},
+	}, nil
+}
+
+func dialThrough(jump *ssh.Client, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := jump.Dial("tcp", address)
+
+	if err != nil {
+		return nil, err
 	}
 
-	if sshInfo.User == "" {
-		return result, sshInfo, fmt.Errorf("'User' not found in your SSH config for '%s'", hostKey)
+	clientConn, channels, requests, err := ssh.NewClientConn(conn, address, config)
+
+	if err != nil {
+		conn.Close()
+		return nil, err
 	}
 
-	if sshInfo.IdentityFile == "" {
-		return result, sshInfo, fmt.Errorf("'IdentityFile' not found in your SSH config for '%s'", hostKey)
+	return ssh.NewClient(clientConn, channels, requests), nil
+}
+
+/*
+resolveJumpHost resolves a ProxyJump entry, [user@]host[:port]. The host
+may be an alias from the SSH config, and an explicit user or port wins
+over the config's.
+*/
+func resolveJumpHost(jump string) (parsing.SSHHost, error) {
+	var (
+		err  error
+		host parsing.SSHHost
+	)
+
+	jumpUser, address, hasUser := strings.Cut(jump, "@")
+
+	if !hasUser {
+		address = jumpUser
+		jumpUser = ""
 	}
 
-	if auth, err = goph.Key(sshInfo.IdentityFile, ""); err != nil {
-		return result, sshInfo, fmt.Errorf("There was an error parsing your SSH key '%s': %s", sshInfo.IdentityFile, err.Error())
+	name, port, hasPort := strings.Cut(address, ":")
+
+	if host, _, err = resolveHost(name); err != nil {
+		return host, fmt.Errorf("Jump host '%s': %s", jump, err.Error())
 	}
 
-	if result, err = goph.New(sshInfo.User, sshInfo.HostName, auth); err != nil {
-		return result, sshInfo, fmt.Errorf("There was a problem setting up an SSH client to '%s' (user '%s'): %s", sshInfo.HostName, sshInfo.User, err.Error())
+	if jumpUser != "" {
+		host.User = jumpUser
 	}
 
-	return result, sshInfo, nil
+	if hasPort {
+		if host.Port, err = strconv.Atoi(port); err != nil {
+			return host, fmt.Errorf("Jump host '%s' has an invalid port", jump)
+		}
+	}
+
+	return host, nil
+}
+
+/*
+clientConfig sets up authentication and host key checking for host.
+*/
+func clientConfig(host parsing.SSHHost, prompt HostKeyPrompt) (*ssh.ClientConfig, error) {
+	var (
+		err  error
+		auth []ssh.AuthMethod
+	)
+
+	if auth, err = authMethods(host); err != nil {
+		return nil, err
+	}
+
+	checker := NewHostKeyChecker(host, prompt)
+
+	return &ssh.ClientConfig{
+		User:              host.User,
+		Auth:              auth,
+		Timeout:           goph.DefaultTimeout,
+		HostKeyCallback:   checker.Callback(),
+		HostKeyAlgorithms: checker.Algorithms(host.Address()),
+	}, nil
 }
 
 func GetClient(hostKey string) (*goph.Client, contextinfo.ContextInfo, error) {
-	return getClient(hostKey)
+	return getClient(hostKey, nil)
+}
+
+/*
+GetClientWithPrompt is GetClient, but asks prompt whether to trust hosts
+that aren't in known_hosts yet, when StrictHostKeyChecking allows it.
+*/
+func GetClientWithPrompt(hostKey string, prompt HostKeyPrompt) (*goph.Client, contextinfo.ContextInfo, error) {
+	return getClient(hostKey, prompt)
+}
+
+/*
+GetHostInfo reads the connection details for a host from the SSH
+config file without connecting to it.
+*/
+func GetHostInfo(hostKey string) (contextinfo.ContextInfo, error) {
+	return getHostInfo(hostKey)
+}
+
+/*
+GetHostInfoFromProject is GetHostInfo with the project's settings
+filled in, the same as GetClientFromProject.
+*/
+func GetHostInfoFromProject(proj *project.PusherProject) (contextinfo.ContextInfo, error) {
+	info, err := getHostInfo(proj.Host)
+	ApplyProject(&info, proj)
+
+	return info, err
 }
 
 func GetClientFromProject(proj *project.PusherProject) (*goph.Client, contextinfo.ContextInfo, error) {
-	client, info, err := getClient(proj.Host)
-	info.Email = proj.CertEmail
-	info.Port = strconv.Itoa(proj.Port)
-	info.ServiceName = proj.ServiceName
+	client, info, err := getClient(proj.Host, nil)
+	ApplyProject(&info, proj)
 
 	return client, info, err
 }
 
-func getValue(line string) (string, error) {
-	split := strings.Split(line, " ")
-
-	if len(split) != 2 {
-		return "", fmt.Errorf("Invalid line in SSH config file: '%s'", line)
+/*
+ApplyProject fills in the project's settings that commands use in their
+templates.
+*/
+func ApplyProject(info *contextinfo.ContextInfo, proj *project.PusherProject) {
+	info.Dependencies = proj.Dependencies
+	info.Domain = proj.Domain
+	info.Email = proj.CertEmail
+	info.EnvFile = proj.RemoteEnvFileName()
+	info.HealthCheck = contextinfo.HealthCheckInfo{
+		Path:           proj.HealthCheck.GetPath(),
+		ExpectedStatus: strconv.Itoa(proj.HealthCheck.GetExpectedStatus()),
+		Timeout:        strconv.Itoa(proj.HealthCheck.GetTimeout()),
+		Retries:        strconv.Itoa(proj.HealthCheck.GetRetries()),
 	}
-
-	return split[1], nil
+	info.KeepImages = proj.GetKeepImages()
+	info.MountDirectories = proj.MountDirectories()
+	info.Mounts = proj.Mounts.ToStrings()
+	info.Port = strconv.Itoa(proj.Port)
+	info.ServiceName = proj.ServiceName
 }
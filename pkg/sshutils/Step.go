@@ -22,29 +22,69 @@ THE SOFTWARE.
 package sshutils
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/adampresley/pusher/pkg/contextinfo"
 	"github.com/adampresley/pusher/pkg/rendering"
-	"github.com/melbahja/goph"
 	"github.com/pterm/pterm"
 )
 
+/*
+Step is a group of commands run one after the other on the server, with a
+spinner showing which one is running. When a command fails, after any
+retries, the rest are skipped. Cancelling ctx stops the command that is
+running on the server.
+*/
 type Step struct {
 	Commands        []Command
 	StartingMessage string
 	SuccessMessage  string
 	ErrorMessage    string
+
+	// Timeout stops the step, and the command it is running, after this
+	// long. Zero means no limit.
+	Timeout time.Duration
+}
+
+/*
+TimeoutError is returned when a command runs longer than its Timeout.
+*/
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s", e.Timeout)
 }
 
-func (s *Step) Run(sshClient *goph.Client, info contextinfo.ContextInfo, debug bool) error {
+func (s *Step) Run(ctx context.Context, executor Executor, info contextinfo.ContextInfo, debug bool) error {
 	var (
-		err error
+		err    error
+		parent = ctx
 	)
 
+	if info.DryRun {
+		s.print(info)
+		return nil
+	}
+
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
 	spinner := rendering.Spinner(s.StartingMessage)
 
-	if err = s.runCommands(sshClient, info, spinner, debug); err != nil {
+	if err = s.runCommands(ctx, executor, info, spinner, debug); err != nil {
+		if parent.Err() == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("The step did not finish within %s: %w", s.Timeout, err)
+		}
+
 		spinner.Fail(fmt.Sprintf("%s: %s", s.ErrorMessage, err))
 		return err
 	}
@@ -53,38 +93,145 @@ func (s *Step) Run(sshClient *goph.Client, info contextinfo.ContextInfo, debug b
 	return nil
 }
 
-func (s *Step) runCommands(sshClient *goph.Client, info contextinfo.ContextInfo, spinner *pterm.SpinnerPrinter, debug bool) error {
+func (s *Step) runCommands(ctx context.Context, executor Executor, info contextinfo.ContextInfo, spinner *pterm.SpinnerPrinter, debug bool) error {
+	var (
+		err     error
+		summary = runSummaryFrom(ctx)
+	)
+
 	for _, cmd := range s.Commands {
-		var (
-			err error
-			b   []byte
-		)
+		result := CommandResult{
+			Step:    s.StartingMessage,
+			Message: cmd.Message,
+			Command: cmd.Command,
+		}
+
+		if err != nil {
+			result.Status = CommandSkipped
+			summary.add(result)
+			continue
+		}
+
+		started := time.Now()
+		result.Attempts, err = s.runWithRetry(ctx, executor, info, cmd, spinner, debug)
+		result.Duration = time.Since(started)
+		result.Err = err
+
+		switch {
+		case err != nil:
+			result.Status = CommandFailed
+
+		case result.Attempts > 1:
+			result.Status = CommandRetried
+
+		default:
+			result.Status = CommandRan
+		}
 
-		spinner.UpdateText(cmd.Message)
+		summary.add(result)
 
-		if b, err = s.runCommand(sshClient, info, cmd, debug); err != nil {
+		if errors.Is(err, context.Canceled) {
+			err = fmt.Errorf("Cancelled while running '%s': %w", cmd.Command, err)
+		} else if err != nil {
+			err = fmt.Errorf("There was an error running the command '%s': %w", cmd.Command, err)
+		}
+	}
+
+	return err
+}
+
+/*
+runWithRetry runs a command until it succeeds or runs out of attempts,
+and returns how many attempts it took.
+*/
+func (s *Step) runWithRetry(ctx context.Context, executor Executor, info contextinfo.ContextInfo, command Command, spinner *pterm.SpinnerPrinter, debug bool) (int, error) {
+	var (
+		err error
+		b   []byte
+	)
+
+	attempts := command.Retry.attempts()
+	spinner.UpdateText(command.Message)
+
+	for attempt := 1; ; attempt++ {
+		if b, err = s.runCommand(ctx, executor, info, command, debug); err == nil {
 			if debug {
-				rendering.Warning("DEBUG INFORMATION:")
-				rendering.Paragraph(string(b))
+				rendering.Paragraph("DEBUG: %s", string(b))
 			}
 
-			return fmt.Errorf("There was an error running the command '%s': %s", cmd, err.Error())
+			return attempt, nil
 		}
 
 		if debug {
-			rendering.Paragraph("DEBUG: %s", string(b))
+			rendering.Warning("DEBUG INFORMATION:")
+			rendering.Paragraph(string(b))
 		}
-	}
 
-	return nil
+		if attempt >= attempts || ctx.Err() != nil {
+			return attempt, err
+		}
+
+		delay := command.Retry.delay(attempt)
+		spinner.UpdateText(fmt.Sprintf("%s (attempt %d of %d failed, retrying in %s)", command.Message, attempt, attempts, delay))
+
+		select {
+		case <-ctx.Done():
+			return attempt, ctx.Err()
+
+		case <-time.After(delay):
+		}
+
+		spinner.UpdateText(fmt.Sprintf("%s (attempt %d of %d)", command.Message, attempt+1, attempts))
+	}
 }
 
-func (s *Step) runCommand(sshClient *goph.Client, info contextinfo.ContextInfo, command Command, debug bool) ([]byte, error) {
+func (s *Step) runCommand(ctx context.Context, executor Executor, info contextinfo.ContextInfo, command Command, debug bool) ([]byte, error) {
+	var (
+		err error
+		b   []byte
+	)
+
 	cmd := info.ExpandCommand(command.Command)
+	commandCtx := ctx
 
 	if debug {
 		rendering.Print("COMMAND: %s", cmd)
 	}
 
-	return sshClient.Run(cmd)
+	if command.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		commandCtx, cancel = context.WithTimeout(ctx, command.Timeout)
+		defer cancel()
+	}
+
+	b, err = executor.Run(commandCtx, cmd)
+
+	if err != nil && ctx.Err() == nil && errors.Is(commandCtx.Err(), context.DeadlineExceeded) {
+		err = &TimeoutError{Timeout: command.Timeout}
+	}
+
+	return b, err
+}
+
+/*
+print writes each command as it would be sent to the server,
+without connecting to it.
+*/
+func (s *Step) print(info contextinfo.ContextInfo) {
+	rendering.Print("# %s", s.StartingMessage)
+
+	for _, cmd := range s.Commands {
+		rendering.Print("%s", info.ExpandCommand(cmd.Command))
+	}
+
+	rendering.BlankLine()
+}
+
+/*
+isTimeout reports whether err is from a command or step running out of time.
+*/
+func isTimeout(err error) bool {
+	var timeout *TimeoutError
+	return errors.As(err, &timeout) || errors.Is(err, context.DeadlineExceeded)
 }
@@ -0,0 +1,200 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package sshutils_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adampresley/pusher/pkg/contextinfo"
+	"github.com/adampresley/pusher/pkg/sshtest"
+	"github.com/adampresley/pusher/pkg/sshutils"
+	"github.com/pterm/pterm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStepRetries(t *testing.T) {
+	pterm.DisableOutput()
+	defer pterm.EnableOutput()
+
+	tests := []struct {
+		name         string
+		failures     int
+		retry        sshutils.RetryPolicy
+		wantErr      bool
+		wantStatuses []sshutils.CommandStatus
+		wantAttempts []int
+	}{
+		{
+			name:         "no retry policy runs once",
+			failures:     1,
+			wantErr:      true,
+			wantStatuses: []sshutils.CommandStatus{sshutils.CommandFailed, sshutils.CommandSkipped},
+			wantAttempts: []int{1, 0},
+		},
+		{
+			name:         "succeeds after retrying",
+			failures:     2,
+			retry:        sshutils.RetryPolicy{Attempts: 3, Delay: time.Millisecond},
+			wantStatuses: []sshutils.CommandStatus{sshutils.CommandRetried, sshutils.CommandRan},
+			wantAttempts: []int{3, 1},
+		},
+		{
+			name:         "gives up after the last attempt",
+			failures:     5,
+			retry:        sshutils.RetryPolicy{Attempts: 3, Delay: time.Millisecond, MaxDelay: 2 * time.Millisecond},
+			wantErr:      true,
+			wantStatuses: []sshutils.CommandStatus{sshutils.CommandFailed, sshutils.CommandSkipped},
+			wantAttempts: []int{3, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failures := tt.failures
+			recorder := &sshtest.Recorder{
+				Handler: func(command string, stdin []byte) (string, int) {
+					if command == "sudo apt update -y" && failures > 0 {
+						failures--
+						return "E: Could not get lock /var/lib/dpkg/lock-frontend", 100
+					}
+
+					return "", 0
+				},
+			}
+
+			step := sshutils.Step{
+				Commands: []sshutils.Command{
+					sshutils.NewCommand("sudo apt update -y", "Updating...").WithRetry(tt.retry),
+					sshutils.NewCommand("sudo apt upgrade -y", "Upgrading..."),
+				},
+				StartingMessage: "Testing...",
+			}
+
+			summary := sshutils.NewRunSummary()
+			err := step.Run(sshutils.WithRunSummary(context.Background(), summary), recorder, contextinfo.ContextInfo{}, false)
+			assert.Equal(t, tt.wantErr, err != nil)
+
+			statuses := []sshutils.CommandStatus{}
+			attempts := []int{}
+
+			for _, result := range summary.Results() {
+				statuses = append(statuses, result.Status)
+				attempts = append(attempts, result.Attempts)
+			}
+
+			assert.Equal(t, tt.wantStatuses, statuses)
+			assert.Equal(t, tt.wantAttempts, attempts)
+		})
+	}
+}
+
+func TestStepCommandTimeout(t *testing.T) {
+	pterm.DisableOutput()
+	defer pterm.EnableOutput()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	server := sshtest.NewServer(t)
+	server.Handler = func(command string, stdin []byte) (string, int) {
+		if command == "sudo apt upgrade -y" {
+			<-release
+		}
+
+		return "", 0
+	}
+
+	step := sshutils.Step{
+		Commands: []sshutils.Command{
+			sshutils.NewCommand("sudo apt upgrade -y", "Upgrading...").WithTimeout(50 * time.Millisecond),
+			sshutils.NewCommand("echo never", "Never run..."),
+		},
+	}
+
+	summary := sshutils.NewRunSummary()
+	err := step.Run(sshutils.WithRunSummary(context.Background(), summary), sshutils.NewGophExecutor(server.Dial(t)), contextinfo.ContextInfo{}, false)
+
+	var timeout *sshutils.TimeoutError
+	assert.True(t, errors.As(err, &timeout))
+
+	assert.Equal(t, []string{"sudo apt upgrade -y"}, server.Commands())
+	assert.Eventually(t, func() bool { return len(server.Signals()) > 0 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "TERM", server.Signals()[0])
+
+	results := summary.Results()
+	assert.Equal(t, sshutils.CommandFailed, results[0].Status)
+	assert.Equal(t, sshutils.CommandSkipped, results[1].Status)
+}
+
+func TestStepTimeout(t *testing.T) {
+	pterm.DisableOutput()
+	defer pterm.EnableOutput()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	server := sshtest.NewServer(t)
+	server.Handler = func(command string, stdin []byte) (string, int) {
+		<-release
+		return "", 0
+	}
+
+	step := sshutils.Step{
+		Commands: []sshutils.Command{sshutils.NewCommand("sudo apt upgrade -y", "Upgrading...")},
+		Timeout:  50 * time.Millisecond,
+	}
+
+	err := step.Run(context.Background(), sshutils.NewGophExecutor(server.Dial(t)), contextinfo.ContextInfo{}, false)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestStepCancelled(t *testing.T) {
+	pterm.DisableOutput()
+	defer pterm.EnableOutput()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	recorder := &sshtest.Recorder{
+		Handler: func(command string, stdin []byte) (string, int) {
+			cancel()
+			return "", 1
+		},
+	}
+
+	step := sshutils.Step{
+		Commands: []sshutils.Command{
+			sshutils.NewCommand("sudo apt update -y", "Updating...").WithRetry(sshutils.RetryPolicy{Attempts: 3, Delay: time.Hour}),
+			sshutils.NewCommand("sudo apt upgrade -y", "Upgrading..."),
+		},
+	}
+
+	summary := sshutils.NewRunSummary()
+	err := step.Run(sshutils.WithRunSummary(ctx, summary), recorder, contextinfo.ContextInfo{}, false)
+	assert.Error(t, err)
+
+	assert.Equal(t, []string{"sudo apt update -y"}, recorder.Commands(), "a cancelled command isn't retried")
+	assert.Equal(t, sshutils.CommandSkipped, summary.Results()[1].Status)
+}
@@ -0,0 +1,140 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package sshutils
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adampresley/pusher/pkg/rendering"
+)
+
+type CommandStatus string
+
+const (
+	CommandRan     CommandStatus = "ran"
+	CommandRetried CommandStatus = "retried"
+	CommandFailed  CommandStatus = "failed"
+	CommandSkipped CommandStatus = "skipped"
+)
+
+/*
+CommandResult is what happened to one command in a Step. Command is the
+template, before it is expanded, so secrets don't end up in the summary.
+Attempts is zero for a command that was skipped because an earlier one
+failed.
+*/
+type CommandResult struct {
+	Step     string
+	Message  string
+	Command  string
+	Status   CommandStatus
+	Attempts int
+	Duration time.Duration
+	Err      error
+}
+
+/*
+RunSummary collects the result of every command the steps in a run
+send to the server. Attach it to the context passed to Step.Run with
+WithRunSummary.
+*/
+type RunSummary struct {
+	lock    sync.Mutex
+	results []CommandResult
+}
+
+type runSummaryKey struct{}
+
+func NewRunSummary() *RunSummary {
+	return &RunSummary{}
+}
+
+/*
+WithRunSummary returns a context that records the results of steps run
+with it into summary.
+*/
+func WithRunSummary(ctx context.Context, summary *RunSummary) context.Context {
+	return context.WithValue(ctx, runSummaryKey{}, summary)
+}
+
+func runSummaryFrom(ctx context.Context) *RunSummary {
+	summary, _ := ctx.Value(runSummaryKey{}).(*RunSummary)
+	return summary
+}
+
+func (s *RunSummary) add(result CommandResult) {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.results = append(s.results, result)
+}
+
+/*
+Results returns the results recorded so far, in order.
+*/
+func (s *RunSummary) Results() []CommandResult {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]CommandResult{}, s.results...)
+}
+
+/*
+Print renders the results as a table. Nothing is printed when no
+commands were run, such as on a dry run.
+*/
+func (s *RunSummary) Print() {
+	results := s.Results()
+
+	if len(results) == 0 {
+		return
+	}
+
+	rows := [][]string{{"Step", "Command", "Result", "Attempts", "Time"}}
+
+	for _, result := range results {
+		status := string(result.Status)
+
+		if result.Status == CommandFailed && isTimeout(result.Err) {
+			status = "timed out"
+		}
+
+		rows = append(rows, []string{
+			strings.TrimSuffix(result.Step, "..."),
+			strings.TrimSuffix(result.Message, "..."),
+			status,
+			strconv.Itoa(result.Attempts),
+			result.Duration.Round(100 * time.Millisecond).String(),
+		})
+	}
+
+	rendering.BlankLine()
+	rendering.Table(rows)
+}
@@ -0,0 +1,145 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package sshutils
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/melbahja/goph"
+)
+
+/*
+Tunnel forwards connections made to a local address over an SSH
+connection to an address on the server, like `ssh -L`.
+*/
+type Tunnel struct {
+	client        *goph.Client
+	listener      net.Listener
+	remoteAddress string
+	wg            sync.WaitGroup
+	mutex         sync.Mutex
+	connections   map[net.Conn]struct{}
+}
+
+/*
+OpenTunnel starts listening on localAddress and forwards each connection
+to remoteAddress on the server. Use "127.0.0.1:0" to pick a free port.
+*/
+func OpenTunnel(client *goph.Client, localAddress, remoteAddress string) (*Tunnel, error) {
+	var (
+		err      error
+		listener net.Listener
+	)
+
+	if listener, err = net.Listen("tcp", localAddress); err != nil {
+		return nil, fmt.Errorf("Unable to listen on '%s': %s", localAddress, err.Error())
+	}
+
+	result := &Tunnel{
+		client:        client,
+		listener:      listener,
+		remoteAddress: remoteAddress,
+		connections:   map[net.Conn]struct{}{},
+	}
+
+	go result.serve()
+	return result, nil
+}
+
+/*
+LocalPort returns the port the tunnel is listening on.
+*/
+func (t *Tunnel) LocalPort() int {
+	return t.listener.Addr().(*net.TCPAddr).Port
+}
+
+/*
+Close stops accepting connections, closes the open ones, and waits for
+them to finish.
+*/
+func (t *Tunnel) Close() error {
+	err := t.listener.Close()
+
+	t.mutex.Lock()
+
+	for conn := range t.connections {
+		_ = conn.Close()
+	}
+
+	t.mutex.Unlock()
+	t.wg.Wait()
+
+	return err
+}
+
+func (t *Tunnel) serve() {
+	for {
+		conn, err := t.listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		t.wg.Add(1)
+		go t.forward(conn)
+	}
+}
+
+func (t *Tunnel) forward(local net.Conn) {
+	defer t.wg.Done()
+	defer local.Close()
+
+	t.mutex.Lock()
+	t.connections[local] = struct{}{}
+	t.mutex.Unlock()
+
+	defer func() {
+		t.mutex.Lock()
+		delete(t.connections, local)
+		t.mutex.Unlock()
+	}()
+
+	remote, err := t.client.Dial("tcp", t.remoteAddress)
+
+	if err != nil {
+		return
+	}
+
+	defer remote.Close()
+
+	done := make(chan struct{}, 2)
+
+	go func() {
+		_, _ = io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+
+	go func() {
+		_, _ = io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+
+	<-done
+}
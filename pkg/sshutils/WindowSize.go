@@ -0,0 +1,63 @@
+//go:build !windows
+
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package sshutils
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+/*
+forwardWindowSize tells the server whenever our terminal is resized.
+Call the returned function to stop.
+*/
+func forwardWindowSize(session *ssh.Session, fd int) func() {
+	resized := make(chan os.Signal, 1)
+	done := make(chan struct{})
+
+	signal.Notify(resized, syscall.SIGWINCH)
+
+	go func() {
+		for {
+			select {
+			case <-resized:
+				if width, height, err := term.GetSize(fd); err == nil {
+					_ = session.WindowChange(height, width)
+				}
+
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(resized)
+		close(done)
+	}
+}
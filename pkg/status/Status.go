@@ -0,0 +1,236 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package status
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*
+Report is everything 'pusher status' knows about the server.
+*/
+type Report struct {
+	Application     ContainerStatus   `json:"application"`
+	Version         int               `json:"version"`
+	ActiveVersion   int               `json:"activeVersion"`
+	ExpectedVersion int               `json:"expectedVersion"`
+	UpToDate        bool              `json:"upToDate"`
+	Traefik         TraefikStatus     `json:"traefik"`
+	Services        []ContainerStatus `json:"services"`
+}
+
+/*
+ContainerStatus describes a single container. State is "missing" when
+there is no container with that name.
+*/
+type ContainerStatus struct {
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	Health    string    `json:"health,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+	Uptime    string    `json:"uptime,omitempty"`
+	Restarts  int       `json:"restarts"`
+	Image     string    `json:"image,omitempty"`
+	ImageTag  string    `json:"imageTag,omitempty"`
+	CPU       string    `json:"cpu,omitempty"`
+	Memory    string    `json:"memory,omitempty"`
+}
+
+type TraefikStatus struct {
+	Container ContainerStatus `json:"container"`
+	Domain    string          `json:"domain"`
+
+	// RouterStatus is the HTTP status Traefik returns for the domain.
+	// A 404 means Traefik has no router for it.
+	RouterStatus int    `json:"routerStatus"`
+	Router       string `json:"router"`
+
+	CertificateIssuer  string    `json:"certificateIssuer,omitempty"`
+	CertificateExpires time.Time `json:"certificateExpires"`
+	CertificateDays    int       `json:"certificateDaysLeft,omitempty"`
+}
+
+const (
+	StateMissing string = "missing"
+)
+
+type dockerInspect struct {
+	Name         string
+	RestartCount int
+	State        struct {
+		Status    string
+		StartedAt time.Time
+		Health    *struct {
+			Status string
+		}
+	}
+	Config struct {
+		Image string
+	}
+}
+
+type dockerStats struct {
+	Name     string
+	CPUPerc  string
+	MemUsage string
+}
+
+/*
+ParseContainers reads the output of 'docker inspect' and
+'docker stats --format "{{json .}}"' and returns the status of each
+container in names, in order.
+*/
+func ParseContainers(names []string, inspectOutput, statsOutput []byte, now time.Time) ([]ContainerStatus, error) {
+	var (
+		err      error
+		inspects []dockerInspect
+	)
+
+	if len(bytes.TrimSpace(inspectOutput)) > 0 {
+		if err = json.Unmarshal(inspectOutput, &inspects); err != nil {
+			return nil, fmt.Errorf("Unable to read docker inspect output: %s", err.Error())
+		}
+	}
+
+	stats := map[string]dockerStats{}
+	scanner := bufio.NewScanner(bytes.NewReader(statsOutput))
+
+	for scanner.Scan() {
+		s := dockerStats{}
+
+		if json.Unmarshal(scanner.Bytes(), &s) == nil {
+			stats[s.Name] = s
+		}
+	}
+
+	result := []ContainerStatus{}
+
+	for _, name := range names {
+		container := ContainerStatus{Name: name, State: StateMissing}
+
+		for _, inspect := range inspects {
+			if strings.TrimPrefix(inspect.Name, "/") != name {
+				continue
+			}
+
+			container.State = inspect.State.Status
+			container.Restarts = inspect.RestartCount
+			container.Image = inspect.Config.Image
+
+			if _, tag, found := strings.Cut(inspect.Config.Image, ":"); found {
+				container.ImageTag = tag
+			}
+
+			if inspect.State.Health != nil {
+				container.Health = inspect.State.Health.Status
+			}
+
+			if inspect.State.Status == "running" {
+				container.StartedAt = inspect.State.StartedAt
+				container.Uptime = FormatDuration(now.Sub(inspect.State.StartedAt))
+			}
+		}
+
+		if s, found := stats[name]; found && container.State == "running" {
+			container.CPU = s.CPUPerc
+			container.Memory = s.MemUsage
+		}
+
+		result = append(result, container)
+	}
+
+	return result, nil
+}
+
+/*
+ParseCertificate reads the output of 'openssl x509 -noout -enddate -issuer'.
+*/
+func ParseCertificate(output []byte, status *TraefikStatus, now time.Time) {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+
+		if !found {
+			continue
+		}
+
+		switch strings.TrimSpace(key) {
+		case "notAfter":
+			if expires, err := time.Parse("Jan _2 15:04:05 2006 MST", strings.TrimSpace(value)); err == nil {
+				status.CertificateExpires = expires.UTC()
+				status.CertificateDays = int(expires.Sub(now).Hours() / 24)
+			}
+
+		case "issuer":
+			status.CertificateIssuer = strings.TrimSpace(value)
+		}
+	}
+}
+
+/*
+DescribeRouter explains the HTTP status Traefik returned for the domain.
+*/
+func DescribeRouter(httpStatus int) string {
+	switch {
+	case httpStatus == 0:
+		return "unreachable"
+
+	case httpStatus == 404:
+		return "no router (404)"
+
+	case httpStatus >= 500:
+		return fmt.Sprintf("error (%d)", httpStatus)
+
+	default:
+		return fmt.Sprintf("active (%d)", httpStatus)
+	}
+}
+
+/*
+FormatDuration returns a short, human readable duration such as
+"3d 4h" or "12m".
+*/
+func FormatDuration(d time.Duration) string {
+	days := int(d.Hours()) / 24
+	hours := int(d.Hours()) % 24
+	minutes := int(d.Minutes()) % 60
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+
+	case minutes > 0:
+		return fmt.Sprintf("%dm", minutes)
+
+	default:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package status_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adampresley/pusher/pkg/status"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseContainers(t *testing.T) {
+	now := time.Date(2024, 5, 3, 12, 0, 0, 0, time.UTC)
+	inspect := []byte(`[
+		{"Name": "/app-blue", "RestartCount": 2, "State": {"Status": "running", "StartedAt": "2024-05-01T10:00:00Z", "Health": {"Status": "healthy"}}, "Config": {"Image": "app:7"}},
+		{"Name": "/postgres", "RestartCount": 0, "State": {"Status": "exited", "StartedAt": "2024-05-01T10:00:00Z"}, "Config": {"Image": "postgres:15.2"}}
+	]`)
+	stats := []byte(`{"Name":"app-blue","CPUPerc":"0.50%","MemUsage":"20MiB / 1.9GiB"}` + "\n")
+
+	got, err := status.ParseContainers([]string{"app-blue", "traefik", "postgres"}, inspect, stats, now)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []status.ContainerStatus{
+		{
+			Name:      "app-blue",
+			State:     "running",
+			Health:    "healthy",
+			StartedAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+			Uptime:    "2d 2h",
+			Restarts:  2,
+			Image:     "app:7",
+			ImageTag:  "7",
+			CPU:       "0.50%",
+			Memory:    "20MiB / 1.9GiB",
+		},
+		{Name: "traefik", State: status.StateMissing},
+		{Name: "postgres", State: "exited", Image: "postgres:15.2", ImageTag: "15.2"},
+	}, got)
+}
+
+func TestParseCertificate(t *testing.T) {
+	now := time.Date(2024, 5, 3, 12, 0, 0, 0, time.UTC)
+	result := status.TraefikStatus{}
+
+	status.ParseCertificate([]byte("notAfter=Jun  2 12:00:00 2024 GMT\nissuer=C = US, O = Let's Encrypt, CN = R3\n"), &result, now)
+
+	assert.Equal(t, time.Date(2024, 6, 2, 12, 0, 0, 0, time.UTC), result.CertificateExpires)
+	assert.Equal(t, 30, result.CertificateDays)
+	assert.Equal(t, "C = US, O = Let's Encrypt, CN = R3", result.CertificateIssuer)
+}
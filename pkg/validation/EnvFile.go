@@ -0,0 +1,136 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+
+	"github.com/adampresley/pusher/pkg/envfile"
+	"github.com/adampresley/pusher/pkg/project"
+)
+
+/*
+EnvFileReport lists everything wrong with an env file. Each slice holds
+keys, except Invalid, which holds a description of each value that
+doesn't match its pattern.
+*/
+type EnvFileReport struct {
+	Duplicate []string
+	Empty     []string
+	Extra     []string
+	Invalid   []string
+	Missing   []string
+}
+
+func (r EnvFileReport) IsValid() bool {
+	return len(r.Duplicate) == 0 &&
+		len(r.Empty) == 0 &&
+		len(r.Extra) == 0 &&
+		len(r.Invalid) == 0 &&
+		len(r.Missing) == 0
+}
+
+/*
+ValidateEnvFile checks an env file against the project's schema and,
+when example isn't nil, against the keys in the example file. Only
+required keys must have a value, and a pattern must match the whole
+value.
+*/
+func ValidateEnvFile(file *envfile.EnvFile, schema project.EnvSchema, example *envfile.EnvFile) (EnvFileReport, error) {
+	result := EnvFileReport{}
+	values := file.Map()
+	seen := map[string]bool{}
+	required := map[string]bool{}
+
+	for _, key := range schema.Required {
+		required[key] = true
+	}
+
+	for _, v := range file.Variables() {
+		if seen[v.Key] {
+			if !slices.Contains(result.Duplicate, v.Key) {
+				result.Duplicate = append(result.Duplicate, v.Key)
+			}
+
+			continue
+		}
+
+		seen[v.Key] = true
+
+		if v.Value == "" && required[v.Key] {
+			result.Empty = append(result.Empty, v.Key)
+		}
+	}
+
+	expected := map[string]bool{}
+
+	for _, key := range schema.Required {
+		expected[key] = true
+	}
+
+	if example != nil {
+		for key := range example.Map() {
+			expected[key] = true
+		}
+
+		for key := range values {
+			if !expected[key] {
+				result.Extra = append(result.Extra, key)
+			}
+		}
+	}
+
+	for key := range expected {
+		if _, found := values[key]; !found {
+			result.Missing = append(result.Missing, key)
+		}
+	}
+
+	for key, pattern := range schema.Patterns {
+		value, found := values[key]
+
+		if !found || value == "" {
+			continue
+		}
+
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+
+		if err != nil {
+			return result, fmt.Errorf("The pattern for '%s' is not a valid regular expression: %s", key, err.Error())
+		}
+
+		if !re.MatchString(value) {
+			result.Invalid = append(result.Invalid, fmt.Sprintf("%s does not match %s", key, pattern))
+		}
+	}
+
+	sort.Strings(result.Duplicate)
+	sort.Strings(result.Empty)
+	sort.Strings(result.Extra)
+	sort.Strings(result.Invalid)
+	sort.Strings(result.Missing)
+
+	return result, nil
+}
@@ -0,0 +1,103 @@
+/*
+Copyright © 2024 Adam Presley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package validation_test
+
+import (
+	"testing"
+
+	"github.com/adampresley/pusher/pkg/envfile"
+	"github.com/adampresley/pusher/pkg/project"
+	"github.com/adampresley/pusher/pkg/validation"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateEnvFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		schema   project.EnvSchema
+		example  string
+		want     validation.EnvFileReport
+	}{
+		{
+			name:     "valid file",
+			contents: "PORT=8080\nSECRET_KEY=abc\n",
+			schema:   project.EnvSchema{Required: []string{"SECRET_KEY"}, Patterns: map[string]string{"PORT": `^\d+$`}},
+			example:  "PORT=\n",
+			want:     validation.EnvFileReport{},
+		},
+		{
+			name:     "missing required key",
+			contents: "PORT=8080\n",
+			schema:   project.EnvSchema{Required: []string{"SECRET_KEY"}},
+			want:     validation.EnvFileReport{Missing: []string{"SECRET_KEY"}},
+		},
+		{
+			name:     "empty and duplicate values",
+			contents: "A=\nB=1\nB=2\n",
+			schema:   project.EnvSchema{Required: []string{"A"}},
+			want:     validation.EnvFileReport{Empty: []string{"A"}, Duplicate: []string{"B"}},
+		},
+		{
+			name:     "empty values are fine for keys that aren't required",
+			contents: "A=\nB=1\n",
+			schema:   project.EnvSchema{Required: []string{"B"}},
+			want:     validation.EnvFileReport{},
+		},
+		{
+			name:     "value does not match its pattern",
+			contents: "PORT=http\n",
+			schema:   project.EnvSchema{Patterns: map[string]string{"PORT": `^\d+$`}},
+			want:     validation.EnvFileReport{Invalid: []string{`PORT does not match ^\d+$`}},
+		},
+		{
+			name:     "patterns match the whole value",
+			contents: "PORT=abc1\nHOST=db.internal\n",
+			schema:   project.EnvSchema{Patterns: map[string]string{"PORT": `[0-9]+`, "HOST": `[a-z.]+`}},
+			want:     validation.EnvFileReport{Invalid: []string{`PORT does not match [0-9]+`}},
+		},
+		{
+			name:     "compares keys with the example file",
+			contents: "A=1\nEXTRA=1\n",
+			example:  "A=\nB=\n",
+			want:     validation.EnvFileReport{Missing: []string{"B"}, Extra: []string{"EXTRA"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var example *envfile.EnvFile
+
+			file, _ := envfile.ParseString(tt.contents)
+
+			if tt.example != "" {
+				example, _ = envfile.ParseString(tt.example)
+			}
+
+			got, err := validation.ValidateEnvFile(file, tt.schema, example)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.want.IsValid(), got.IsValid())
+		})
+	}
+}